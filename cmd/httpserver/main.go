@@ -1,46 +1,230 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"crypto/sha256"
 	"fmt"
+	"httpfromtcp/internal/accesslog"
+	"httpfromtcp/internal/auth"
+	"httpfromtcp/internal/compression"
+	"httpfromtcp/internal/cors"
+	"httpfromtcp/internal/csrf"
+	"httpfromtcp/internal/fileserver"
+	"httpfromtcp/internal/form"
+	"httpfromtcp/internal/metrics"
+	"httpfromtcp/internal/ratelimit"
 	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/requestid"
 	"httpfromtcp/internal/response"
 	"httpfromtcp/internal/server"
+	"httpfromtcp/internal/sessions"
+	"httpfromtcp/internal/sse"
+	"httpfromtcp/internal/tracing"
+	"httpfromtcp/internal/websocket"
 	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
 const port = 42069
+
+// Connections served at once, in total and from a single client, so a burst
+// can't exhaust file descriptors
+const maxConns = 1024
+const maxConnsPerIP = 64
+
+// Requests allowed per client IP
+var rateLimit = ratelimit.Limit{Requests: 600, Period: time.Minute, Burst: 100}
+
+// How long in-flight requests get to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
+// How long a new process gets to start accepting during an upgrade
+const upgradeTimeout = 10 * time.Second
 const chunkedBufferSize = 1024
 
+var assets = os.DirFS("assets")
+var assetsHandler = fileserver.New(assets, fileserver.Options{Prefix: "/assets", Browse: true})
+
+var upgrader = &websocket.Upgrader{EnableCompression: true}
+
+// Upstream calls to httpbin.org give up after this long
+const httpbinTimeout = 30 * time.Second
+
+// Passes the request's trace on to httpbin.org
+var httpbinClient = &http.Client{Transport: &tracing.Transport{}}
+
+var httpbinStream = server.Chain(streamHandler, server.Timeout(httpbinTimeout))
+var httpbinHTML = server.Chain(htmlHandler, server.Timeout(httpbinTimeout))
+
+var registry = metrics.NewRegistry()
+var httpMetrics = metrics.NewHTTP(registry, metrics.HTTPOptions{Route: route})
+
+// Where the metrics are served, set by METRICS_PATH
+var metricsPath = cmp.Or(os.Getenv("METRICS_PATH"), "/metrics")
+
+// Counts each client's visits in a session kept in memory, with a form to
+// reset the count that other sites can't submit
+var visitsHandler = server.Chain(countVisits,
+	sessions.Middleware(sessions.Options{}),
+	form.Middleware(form.Options{}),
+	csrf.Middleware(csrf.Options{}),
+)
+
+// Metrics are public unless METRICS_TOKEN is set
+var metricsHandler = registry.Handler()
+
 func main() {
-	server, err := server.Serve(port, mainHandler)
+	// Errors logged with a request's context are tagged with its ID
+	slog.SetDefault(slog.New(requestid.NewLogHandler(slog.NewTextHandler(os.Stderr, nil))))
+
+	if token := os.Getenv("METRICS_TOKEN"); token != "" {
+		metricsHandler = server.Chain(metricsHandler, auth.Bearer(auth.BearerOptions{
+			Realm:     "metrics",
+			Validator: auth.Tokens{token: "metrics"},
+		}))
+	}
+
+	accessLog := slog.New(accesslog.NewHandler(os.Stdout, accessLogFormat(os.Getenv("ACCESS_LOG_FORMAT")), nil))
+	middleware := []server.Middleware{
+		requestid.Middleware(requestid.Options{}),
+		httpMetrics.Middleware(),
+		tracing.Middleware(tracing.Options{Exporter: traceExporter(os.Getenv("TRACE_EXPORTER")), Route: route}),
+		accesslog.Middleware(accesslog.Options{Logger: accessLog}),
+	}
+	// Browsers on the comma separated CORS_ORIGINS may call the API.
+	// Preflights are answered before they count against the rate limit.
+	if origins := os.Getenv("CORS_ORIGINS"); origins != "" {
+		allowCORS, err := cors.Middleware(cors.Options{
+			AllowedOrigins: strings.Split(origins, ","),
+			AllowedMethods: []string{"GET", "HEAD", "POST"},
+			AllowedHeaders: []string{"Content-Type", "X-Request-ID"},
+			ExposedHeaders: []string{"X-Request-ID", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"},
+			MaxAge:         time.Hour,
+		})
+		if err != nil {
+			log.Fatalf("Error configuring CORS: %v", err)
+		}
+		middleware = append(middleware, allowCORS)
+	}
+	limiter, err := ratelimit.Middleware(ratelimit.Options{Limit: rateLimit})
+	if err != nil {
+		log.Fatalf("Error configuring rate limit: %v", err)
+	}
+	middleware = append(middleware,
+		limiter,
+		compression.Middleware(compression.Options{}),
+		compression.DecodeRequest(compression.DecodeOptions{}),
+	)
+	handler := server.Chain(mainHandler, middleware...)
+
+	listener, err := listen()
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
-	log.Println("Server started on port", port)
+	srv := server.Serve(listener, handler,
+		server.MaxConns(maxConns),
+		server.RejectWhenFull(),
+		server.MaxConnsPerIP(maxConnsPerIP),
+		server.Observe(httpMetrics),
+	)
+	// Let the process we were upgraded from know it can stop
+	if err := server.Ready(); err != nil {
+		log.Printf("Error reporting ready: %v", err)
+	}
+	log.Println("Server started on", srv.Addr())
 
+	// SIGHUP or SIGUSR2 hands the socket to a freshly started copy of the
+	// binary
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM}, upgradeSignals...)...)
+	for sig := range sigChan {
+		if !slices.Contains(upgradeSignals, sig) {
+			break
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), upgradeTimeout)
+		process, err := server.Upgrade(ctx, listener)
+		cancel()
+		if err != nil {
+			log.Printf("Error upgrading: %v", err)
+			continue
+		}
+		log.Println("Upgraded to process", process.Pid)
+		break
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Error draining connections: %v", err)
+	}
 	log.Println("Server gracefully stopped")
 }
 
+// Access log format named by ACCESS_LOG_FORMAT, combined by default
+func accessLogFormat(name string) accesslog.Format {
+	switch name {
+	case "json":
+		return accesslog.FormatJSON
+	case "common":
+		return accesslog.FormatCommon
+	}
+	return accesslog.FormatCombined
+}
+
+// Span exporter named by TRACE_EXPORTER. Spans are only propagated, not
+// exported, by default.
+func traceExporter(name string) tracing.Exporter {
+	if name == "stdout" {
+		return tracing.NewJSONExporter(os.Stdout)
+	}
+	return nil
+}
+
+// The socket to serve: one handed down by an upgrade, one passed by systemd
+// socket activation, or a new one on port
+func listen() (net.Listener, error) {
+	listeners, err := server.InheritedListeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(listeners) == 0 {
+		listeners, err = server.SystemdListeners()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(listeners) > 0 {
+		return listeners[0], nil
+	}
+
+	return net.Listen("tcp", fmt.Sprintf(":%d", port))
+}
+
 func mainHandler(w *response.Writer, req *request.Request) {
+	if req.RequestLine.RequestTarget == metricsPath {
+		metricsHandler(w, req)
+		return
+	}
+
 	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin/stream") {
-		streamHandler(w, req)
+		httpbinStream(w, req)
 		return
 	}
 
 	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin/html") {
-		htmlHandler(w, req)
+		httpbinHTML(w, req)
 		return
 	}
 
@@ -59,9 +243,45 @@ func mainHandler(w *response.Writer, req *request.Request) {
 		return
 	}
 
+	if req.RequestLine.RequestTarget == "/events" {
+		eventsHandler(w, req)
+		return
+	}
+
+	if req.RequestLine.RequestTarget == "/ws/echo" {
+		echoHandler(w, req)
+		return
+	}
+
+	if req.RequestLine.RequestTarget == "/visits" {
+		visitsHandler(w, req)
+		return
+	}
+
+	if strings.HasPrefix(req.RequestLine.RequestTarget, "/assets") {
+		assetsHandler(w, req)
+		return
+	}
+
 	mainHandler200(w, req)
 }
 
+// The route label of a request's metrics. Targets are folded into the routes
+// mainHandler knows so clients can't create unbounded series.
+func route(req *request.Request) string {
+	target := req.RequestLine.RequestTarget
+	for _, prefix := range []string{"/httpbin/stream", "/httpbin/html", "/assets"} {
+		if strings.HasPrefix(target, prefix) {
+			return prefix
+		}
+	}
+	switch target {
+	case metricsPath, "/yourproblem", "/myproblem", "/video", "/events", "/ws/echo", "/visits":
+		return target
+	}
+	return "other"
+}
+
 func mainHandler400(w *response.Writer, _ *request.Request) {
 	body := []byte("<html>\n<head>\n<title>400 Bad Request</title>\n</head>\n<body>\n" +
 		"<h1>Bad Request</h1>\n<p>Your request honestly kinda sucked.</p>\n" +
@@ -101,6 +321,33 @@ func mainHandler200(w *response.Writer, _ *request.Request) {
 	w.WriteBody(body)
 }
 
+func countVisits(w *response.Writer, req *request.Request) {
+	session := sessions.FromContext(req.Context())
+	if req.RequestLine.Method == "POST" {
+		session.Destroy()
+		body := []byte("Visits reset\n")
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+		return
+	}
+
+	visits, _ := session.Get("visits")
+	count, _ := strconv.Atoi(visits)
+	count++
+	session.Set("visits", strconv.Itoa(count))
+
+	body := []byte(fmt.Sprintf("<html>\n<body>\n<p>Visits: %d</p>\n"+
+		"<form method=\"post\">\n<input type=\"hidden\" name=\"%s\" value=\"%s\">\n"+
+		"<button>Reset</button>\n</form>\n</body>\n</html>", count, csrf.DefaultField, csrf.Token(req.Context())))
+	headers := response.GetDefaultHeaders(len(body))
+	headers.Replace("Content-Type", "text/html")
+
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(headers)
+	w.WriteBody(body)
+}
+
 func streamHandler(w *response.Writer, req *request.Request) {
 	// Trim the request target prefix to get the route parameter
 	param := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
@@ -114,9 +361,16 @@ func streamHandler(w *response.Writer, req *request.Request) {
 	w.WriteHeaders(headers)
 
 	// Call httpbin.org api with route parameter
-	res, err := http.Get("https://httpbin.org/" + param)
+	// Tied to the request context so the call stops if the client leaves
+	upstream, err := http.NewRequestWithContext(req.Context(), "GET", "https://httpbin.org/"+param, nil)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(req.Context(), "handling request", "error", err)
+		return
+	}
+	res, err := httpbinClient.Do(upstream)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "handling request", "error", err)
+		return
 	}
 	defer res.Body.Close()
 
@@ -126,7 +380,7 @@ func streamHandler(w *response.Writer, req *request.Request) {
 		fmt.Printf("httpbin.org response body bytes read: %d\n", n)
 
 		if err != nil && err != io.EOF {
-			log.Println(err)
+			slog.ErrorContext(req.Context(), "handling request", "error", err)
 			return
 		}
 
@@ -153,9 +407,16 @@ func htmlHandler(w *response.Writer, req *request.Request) {
 	w.WriteHeaders(headers)
 
 	// Call httpbin.org api with route parameter
-	res, err := http.Get("https://httpbin.org/" + param)
+	// Tied to the request context so the call stops if the client leaves
+	upstream, err := http.NewRequestWithContext(req.Context(), "GET", "https://httpbin.org/"+param, nil)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(req.Context(), "handling request", "error", err)
+		return
+	}
+	res, err := httpbinClient.Do(upstream)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "handling request", "error", err)
+		return
 	}
 	defer res.Body.Close()
 
@@ -165,7 +426,7 @@ func htmlHandler(w *response.Writer, req *request.Request) {
 		n, err := res.Body.Read(buf)
 
 		if err != nil && err != io.EOF {
-			log.Println(err)
+			slog.ErrorContext(req.Context(), "handling request", "error", err)
 			return
 		}
 
@@ -184,18 +445,57 @@ func htmlHandler(w *response.Writer, req *request.Request) {
 	}
 }
 
-func videoHandler(w *response.Writer, _ *request.Request) {
-	// Read the video file into the response body
-	body, err := os.ReadFile("assets/vim.mp4")
+func videoHandler(w *response.Writer, req *request.Request) {
+	fileserver.ServeFile(w, req, assets, "vim.mp4")
+}
+
+func echoHandler(w *response.Writer, req *request.Request) {
+	conn, err := upgrader.Upgrade(w, req)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(req.Context(), "handling request", "error", err)
+		return
 	}
+	defer conn.Close()
 
-	// Put together the response headers
-	headers := response.GetDefaultHeaders(len(body))
-	headers.Replace("Content-Type", "video/mp4")
+	// Echo every message back until the client closes the connection
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := conn.WriteMessage(messageType, data); err != nil {
+			return
+		}
+	}
+}
 
-	w.WriteStatusLine(response.StatusOK)
-	w.WriteHeaders(headers)
-	w.WriteBody(body)
+func eventsHandler(w *response.Writer, req *request.Request) {
+	events, err := sse.NewWriter(w, req, sse.Options{})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "handling request", "error", err)
+		return
+	}
+	defer events.Close()
+
+	// Resume counting from the last event a reconnecting client saw
+	count, _ := strconv.Atoi(events.LastEventID())
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-events.Done():
+			return
+		case t := <-ticker.C:
+			count++
+			err := events.Send(sse.Event{
+				ID:    strconv.Itoa(count),
+				Event: "tick",
+				Data:  t.UTC().Format(time.RFC3339),
+			})
+			if err != nil {
+				return
+			}
+		}
+	}
 }
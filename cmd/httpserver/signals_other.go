@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Signals that hand the socket to a freshly started copy of the binary.
+// Upgrades aren't supported here, but trying reports why.
+var upgradeSignals = []os.Signal{syscall.SIGHUP}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Signals that hand the socket to a freshly started copy of the binary
+var upgradeSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR2}
@@ -2,9 +2,14 @@ module httpfromtcp
 
 go 1.24.4
 
+require (
+	github.com/stretchr/testify v1.10.0
+	golang.org/x/crypto v0.48.0
+	golang.org/x/sys v0.41.0
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.10.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,72 @@
+package accesslog
+
+import (
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/requestid"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"log/slog"
+	"time"
+)
+
+// Attribute keys of an access log record
+const (
+	KeyRemoteAddr = "remote_addr"
+	KeyMethod     = "method"
+	KeyTarget     = "target"
+	KeyProto      = "proto"
+	KeyStatus     = "status"
+	KeyBytesIn    = "bytes_in"
+	KeyBytesOut   = "bytes_out"
+	KeyDuration   = "duration"
+	KeyUserAgent  = "user_agent"
+	KeyReferer    = "referer"
+	KeyRequestID  = "request_id"
+)
+
+type Options struct {
+	// Logger receives one record per request, slog.Default() when nil. Use
+	// NewHandler for Common or Combined Log Format output.
+	Logger *slog.Logger
+	// Level of the records, Info when zero. The logger's handler must allow
+	// it, see NewHandler.
+	Level slog.Level
+}
+
+// Middleware logs each request once its response is complete, with the size
+// counted by a response.Recorder. It must come after requestid.Middleware
+// for the record to carry the request ID.
+func Middleware(opts Options) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			logger := opts.Logger
+			if logger == nil {
+				logger = slog.Default()
+			}
+
+			start := time.Now()
+			bytesIn := len(req.Body)
+			rec := &response.Recorder{}
+			w.AddFilter(rec)
+
+			w.OnDone(func() {
+				userAgent, _ := req.Headers.Get("User-Agent")
+				referer, _ := req.Headers.Get("Referer")
+				logger.LogAttrs(req.Context(), opts.Level, "request",
+					slog.String(KeyRemoteAddr, req.RemoteAddr),
+					slog.String(KeyMethod, req.RequestLine.Method),
+					slog.String(KeyTarget, req.RequestLine.RequestTarget),
+					slog.String(KeyProto, "HTTP/"+req.RequestLine.HttpVersion),
+					slog.Int(KeyStatus, int(rec.StatusCode)),
+					slog.Int(KeyBytesIn, bytesIn),
+					slog.Int64(KeyBytesOut, rec.BytesWritten),
+					slog.Duration(KeyDuration, time.Since(start)),
+					slog.String(KeyUserAgent, userAgent),
+					slog.String(KeyReferer, referer),
+					slog.String(KeyRequestID, requestid.FromContext(req.Context())),
+				)
+			})
+			next(w, req)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/requestid"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	handler := server.Chain(func(w *response.Writer, req *request.Request) {
+		body := []byte("created")
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	},
+		requestid.Middleware(requestid.Options{}),
+		Middleware(Options{Logger: slog.New(NewHandler(&logs, FormatJSON, nil))}),
+	)
+
+	// Test: One JSON record with every field of the request
+	req, err := request.RequestFromReader(strings.NewReader("POST /items?x=1 HTTP/1.1\r\n" +
+		"Host: localhost\r\nUser-Agent: curl/8.0\r\nReferer: http://example.com/\r\n" +
+		"X-Request-ID: abc123\r\nContent-Length: 4\r\n\r\ndata"))
+	require.NoError(t, err)
+	req.RemoteAddr = "192.0.2.7:51234"
+	var out bytes.Buffer
+	w := response.NewWriter(&out)
+	handler(w, req)
+
+	// Test: Nothing is logged until the response is finished
+	assert.Empty(t, logs.String())
+	require.NoError(t, w.Finish())
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &record))
+	assert.Equal(t, "request", record["msg"])
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "192.0.2.7:51234", record[KeyRemoteAddr])
+	assert.Equal(t, "POST", record[KeyMethod])
+	assert.Equal(t, "/items?x=1", record[KeyTarget])
+	assert.Equal(t, "HTTP/1.1", record[KeyProto])
+	assert.Equal(t, float64(200), record[KeyStatus])
+	assert.Equal(t, float64(4), record[KeyBytesIn])
+	assert.Equal(t, float64(7), record[KeyBytesOut])
+	assert.Equal(t, "curl/8.0", record[KeyUserAgent])
+	assert.Equal(t, "http://example.com/", record[KeyReferer])
+	assert.Equal(t, "abc123", record[KeyRequestID])
+	assert.Contains(t, record, KeyDuration)
+
+	// Test: Response is unchanged
+	assert.True(t, strings.HasSuffix(out.String(), "\r\n\r\ncreated"))
+}
+
+// Holds the body back until closed, like a compressor
+type bufferingFilter struct{}
+
+func (bufferingFilter) Headers(response.StatusCode, headers.Headers) {}
+
+func (bufferingFilter) Body(w io.Writer) io.WriteCloser {
+	return &bufferingWriter{w: w}
+}
+
+type bufferingWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (b *bufferingWriter) Write(p []byte) (int, error) {
+	return b.buf.Write(p)
+}
+
+func (b *bufferingWriter) Close() error {
+	_, err := b.w.Write(b.buf.Bytes())
+	return err
+}
+
+func TestMiddlewareLevelAndFlush(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(NewHandler(&logs, FormatCommon, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	// An outer filter adds a header after the log middleware has run
+	outer := func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			w.AddFilter(headerFilter{})
+			next(w, req)
+		}
+	}
+	inner := func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			w.AddFilter(bufferingFilter{})
+			next(w, req)
+		}
+	}
+	handler := server.Chain(func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		h := response.GetDefaultHeaders(0)
+		h.Remove("Content-Length")
+		w.WriteHeaders(h)
+		w.WriteBody([]byte("hello"))
+	}, outer, Middleware(Options{Logger: logger, Level: slog.LevelDebug}), inner)
+
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	var out bytes.Buffer
+	w := response.NewWriter(&out)
+	handler(w, req)
+	require.NoError(t, w.Finish())
+
+	// Test: Debug records reach a CLF handler that allows them, and the size
+	// counts what the inner filter flushed at the end
+	assert.Contains(t, logs.String(), `"GET / HTTP/1.1" 200 5`+"\n")
+
+	// Test: The outer filter still acted on the response
+	assert.Contains(t, out.String(), "X-Outer: yes\r\n")
+	assert.True(t, strings.HasSuffix(out.String(), "\r\n\r\nhello"))
+}
+
+type headerFilter struct{}
+
+func (headerFilter) Headers(_ response.StatusCode, h headers.Headers) {
+	h.Set("X-Outer", "yes")
+}
+
+func (headerFilter) Body(io.Writer) io.WriteCloser {
+	return nil
+}
@@ -0,0 +1,111 @@
+package accesslog
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+)
+
+type Format int
+
+const (
+	FormatJSON Format = iota
+	// FormatCommon is the Common Log Format of Apache and nginx
+	FormatCommon
+	// FormatCombined adds the referer and user agent to FormatCommon
+	FormatCombined
+)
+
+// Time layout of Common Log Format
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// NewHandler returns a slog.Handler writing access log records to w in the
+// given format, for use as Options.Logger. opts.Level must allow the
+// Options.Level of the middleware; like slog's handlers, Info and above are
+// written when opts or its Level is nil.
+func NewHandler(w io.Writer, format Format, opts *slog.HandlerOptions) slog.Handler {
+	if format == FormatJSON {
+		return slog.NewJSONHandler(w, opts)
+	}
+	var level slog.Leveler = slog.LevelInfo
+	if opts != nil && opts.Level != nil {
+		level = opts.Level
+	}
+	return &clfHandler{
+		w:        w,
+		mu:       &sync.Mutex{},
+		combined: format == FormatCombined,
+		level:    level,
+	}
+}
+
+// Writes records as Common or Combined Log Format lines. Attributes that
+// aren't part of the format are dropped.
+type clfHandler struct {
+	w        io.Writer
+	mu       *sync.Mutex
+	combined bool
+	level    slog.Leveler
+	attrs    []slog.Attr
+}
+
+func (h *clfHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *clfHandler) Handle(_ context.Context, r slog.Record) error {
+	values := map[string]slog.Value{}
+	for _, a := range h.attrs {
+		values[a.Key] = a.Value
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		values[a.Key] = a.Value
+		return true
+	})
+	str := func(key string) string {
+		if v, ok := values[key]; ok {
+			return v.String()
+		}
+		return ""
+	}
+
+	host := str(KeyRemoteAddr)
+	if hostOnly, _, err := net.SplitHostPort(host); err == nil {
+		host = hostOnly
+	}
+	request := str(KeyMethod) + " " + str(KeyTarget) + " " + str(KeyProto)
+
+	line := orDash(host) + " - - [" + r.Time.Format(clfTimeFormat) + "] " +
+		strconv.Quote(request) + " " + orDash(str(KeyStatus)) + " " + orDash(str(KeyBytesOut))
+	if h.combined {
+		line += " " + strconv.Quote(orDash(str(KeyReferer))) + " " + strconv.Quote(orDash(str(KeyUserAgent)))
+	}
+	line += "\n"
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, line)
+	return err
+}
+
+func (h *clfHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &h2
+}
+
+// The format has no nesting, so groups are flattened away
+func (h *clfHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// CLF writes a dash for missing values, including a zero status or size
+func orDash(s string) string {
+	if s == "" || s == "0" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,48 @@
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	record := slog.NewRecord(time.Date(2000, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60)), slog.LevelInfo, "request", 0)
+	record.AddAttrs(
+		slog.String(KeyRemoteAddr, "127.0.0.1:4000"),
+		slog.String(KeyMethod, "GET"),
+		slog.String(KeyTarget, "/apache_pb.gif"),
+		slog.String(KeyProto, "HTTP/1.0"),
+		slog.Int(KeyStatus, 200),
+		slog.Int(KeyBytesOut, 2326),
+		slog.String(KeyUserAgent, `Mozilla/4.08 "quoted"`),
+	)
+
+	// Test: Common Log Format
+	var buf bytes.Buffer
+	assert.NoError(t, NewHandler(&buf, FormatCommon, nil).Handle(context.Background(), record))
+	assert.Equal(t, `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`+"\n", buf.String())
+
+	// Test: Combined Log Format with missing referer and escaped user agent
+	buf.Reset()
+	assert.NoError(t, NewHandler(&buf, FormatCombined, nil).Handle(context.Background(), record))
+	assert.Equal(t, `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "-" "Mozilla/4.08 \"quoted\""`+"\n", buf.String())
+
+	// Test: Empty body is written as a dash, attributes from WithAttrs are used
+	buf.Reset()
+	empty := slog.NewRecord(record.Time, slog.LevelInfo, "request", 0)
+	empty.AddAttrs(slog.Int(KeyStatus, 304), slog.Int(KeyBytesOut, 0))
+	h := NewHandler(&buf, FormatCommon, nil).WithAttrs([]slog.Attr{slog.String(KeyRemoteAddr, "[::1]:80")})
+	assert.NoError(t, h.Handle(context.Background(), empty))
+	assert.Equal(t, `::1 - - [10/Oct/2000:13:55:36 -0700] "  " 304 -`+"\n", buf.String())
+
+	// Test: Levels below the handler's are dropped, others written
+	h = NewHandler(&buf, FormatCommon, &slog.HandlerOptions{Level: slog.LevelDebug})
+	assert.True(t, h.Enabled(context.Background(), slog.LevelDebug))
+	assert.False(t, h.Enabled(context.Background(), slog.LevelDebug-1))
+	assert.False(t, NewHandler(&buf, FormatCombined, nil).Enabled(context.Background(), slog.LevelDebug))
+}
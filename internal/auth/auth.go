@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"strings"
+)
+
+// Principal is who a request was authenticated as.
+type Principal struct {
+	// Name identifies the user or client, such as the Basic username or a
+	// token's subject
+	Name string
+	// Scheme is the authentication scheme used: "Basic", "Bearer" or "Digest"
+	Scheme string
+	// Attributes holds whatever else the checker knows, such as a token's
+	// scopes
+	Attributes map[string]any
+}
+
+type principalKey struct{}
+
+// FromContext returns the principal the auth middleware authenticated the
+// request as, or nil if it wasn't authenticated.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+func withPrincipal(req *request.Request, p *Principal) *request.Request {
+	return req.WithValue(principalKey{}, p)
+}
+
+// The credentials of the Authorization header if it uses scheme, which is
+// matched case-insensitively
+func credentials(req *request.Request, scheme string) (string, bool) {
+	authorization, ok := req.Headers.Get("Authorization")
+	if !ok {
+		return "", false
+	}
+	given, creds, ok := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !ok || !strings.EqualFold(given, scheme) {
+		return "", false
+	}
+	return strings.TrimSpace(creds), true
+}
+
+// Answers with 401 and a WWW-Authenticate challenge
+func writeUnauthorized(w *response.Writer, challenge string) {
+	status := response.StatusUnauthorized
+	body := []byte(fmt.Sprintf("%d %s\n", status, response.StatusText(status)))
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("WWW-Authenticate", challenge)
+
+	w.WriteStatusLine(status)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+// A quoted-string for an auth-param. Characters RFC 6750 doesn't allow in
+// its error parameters are dropped rather than escaped so the result suits
+// both.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range []byte(s) {
+		if c >= 0x20 && c <= 0x7e && c != '"' && c != '\\' {
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"strings"
+)
+
+// Realm sent in challenges unless one is given
+const DefaultRealm = "restricted"
+
+// CredentialChecker decides whether a username and password are valid.
+// Implementations should take the same time whether or not the user exists.
+type CredentialChecker interface {
+	CheckCredentials(username, password string) bool
+}
+
+// CheckerFunc adapts a function to a CredentialChecker.
+type CheckerFunc func(username, password string) bool
+
+func (f CheckerFunc) CheckCredentials(username, password string) bool {
+	return f(username, password)
+}
+
+// Users maps usernames to plain text passwords, for tests and development.
+// Use an Htpasswd file in production.
+type Users map[string]string
+
+func (u Users) CheckCredentials(username, password string) bool {
+	want, ok := u[username]
+	// Compare even for unknown users so the timing doesn't tell them apart.
+	// Hashing first makes the comparison independent of the lengths.
+	given := sha256.Sum256([]byte(password))
+	expected := sha256.Sum256([]byte(want))
+	return subtle.ConstantTimeCompare(given[:], expected[:]) == 1 && ok
+}
+
+type BasicOptions struct {
+	// Realm describes the protected area to the client, DefaultRealm when
+	// empty
+	Realm   string
+	Checker CredentialChecker
+}
+
+// Basic requires HTTP Basic authentication. Requests without valid
+// credentials are answered with 401 Unauthorized and a challenge, others
+// reach the handler with a Principal in their context.
+func Basic(opts BasicOptions) server.Middleware {
+	if opts.Realm == "" {
+		opts.Realm = DefaultRealm
+	}
+	challenge := "Basic realm=" + quote(opts.Realm) + `, charset="UTF-8"`
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			username, password, ok := basicCredentials(req)
+			if !ok || !opts.Checker.CheckCredentials(username, password) {
+				writeUnauthorized(w, challenge)
+				return
+			}
+			next(w, withPrincipal(req, &Principal{Name: username, Scheme: "Basic"}))
+		}
+	}
+}
+
+func basicCredentials(req *request.Request) (username, password string, ok bool) {
+	creds, ok := credentials(req, "Basic")
+	if !ok {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(creds)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"encoding/base64"
+	"httpfromtcp/internal/handlertest"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Runs handler on a GET request with the given extra header lines
+func serve(t *testing.T, handler server.Handler, header string) (*http.Response, string) {
+	t.Helper()
+	return handlertest.Serve(t, handler, handlertest.NewRequest(t, "GET", "/admin", header, ""))
+}
+
+// Writes the name of the authenticated principal
+func whoami(w *response.Writer, req *request.Request) {
+	p := FromContext(req.Context())
+	body := []byte(p.Scheme + " " + p.Name)
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func basicHeader(username, password string) string {
+	return "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)) + "\r\n"
+}
+
+func TestBasic(t *testing.T) {
+	handler := Basic(BasicOptions{
+		Realm:   "admin area",
+		Checker: Users{"alice": "s3cret:with colon"},
+	})(whoami)
+
+	// Test: Valid credentials reach the handler with a principal
+	res, body := serve(t, handler, basicHeader("alice", "s3cret:with colon"))
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "Basic alice", body)
+
+	// Test: Scheme is case-insensitive
+	res, _ = serve(t, handler, strings.Replace(basicHeader("alice", "s3cret:with colon"), "Basic", "basic", 1))
+	assert.Equal(t, 200, res.StatusCode)
+
+	// Test: Missing, wrong and malformed credentials get a challenge
+	for _, header := range []string{
+		"",
+		basicHeader("alice", "wrong"),
+		basicHeader("bob", "s3cret:with colon"),
+		"Authorization: Basic not-base64!\r\n",
+		"Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte("nocolon")) + "\r\n",
+		"Authorization: Bearer abc\r\n",
+	} {
+		res, _ := serve(t, handler, header)
+		assert.Equal(t, 401, res.StatusCode, header)
+		assert.Equal(t, `Basic realm="admin area", charset="UTF-8"`, res.Header.Get("WWW-Authenticate"))
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// TokenValidator checks a bearer token and returns who it was issued to.
+// The error's message is sent to the client as the error_description, so it
+// shouldn't reveal more than why the token was refused. A nil Principal
+// without an error counts as a refused token.
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) (*Principal, error)
+}
+
+// ValidatorFunc adapts a function to a TokenValidator.
+type ValidatorFunc func(ctx context.Context, token string) (*Principal, error)
+
+func (f ValidatorFunc) ValidateToken(ctx context.Context, token string) (*Principal, error) {
+	return f(ctx, token)
+}
+
+// Tokens maps static tokens, such as API keys, to the name of their holder.
+type Tokens map[string]string
+
+func (t Tokens) ValidateToken(_ context.Context, token string) (*Principal, error) {
+	// Every token is compared so the timing doesn't reveal a match
+	given := sha256.Sum256([]byte(token))
+	name := ""
+	for candidate, holder := range t {
+		expected := sha256.Sum256([]byte(candidate))
+		if subtle.ConstantTimeCompare(given[:], expected[:]) == 1 {
+			name = holder
+		}
+	}
+	if name == "" {
+		return nil, ErrInvalidToken
+	}
+	return &Principal{Name: name}, nil
+}
+
+type BearerOptions struct {
+	// Realm describes the protected area to the client, DefaultRealm when
+	// empty
+	Realm     string
+	Validator TokenValidator
+	// Cookie names a cookie to take the token from when the request has no
+	// Authorization header, for browsers. Empty to only accept the header.
+	Cookie string
+}
+
+// Bearer requires a bearer token as in RFC 6750. Requests without a token,
+// or with one the validator refuses, are answered with 401 Unauthorized and
+// a challenge, others reach the handler with the validator's Principal in
+// their context.
+func Bearer(opts BearerOptions) server.Middleware {
+	if opts.Realm == "" {
+		opts.Realm = DefaultRealm
+	}
+	challenge := "Bearer realm=" + quote(opts.Realm)
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			token, ok := credentials(req, "Bearer")
+			if _, hasHeader := req.Headers.Get("Authorization"); !hasHeader && opts.Cookie != "" {
+				if c, found := req.Cookie(opts.Cookie); found {
+					token, ok = c.Value, true
+				}
+			}
+			if !ok || token == "" {
+				// No error code when no credentials were sent
+				writeUnauthorized(w, challenge)
+				return
+			}
+
+			principal, err := opts.Validator.ValidateToken(req.Context(), token)
+			if err == nil && principal == nil {
+				err = ErrInvalidToken
+			}
+			if err != nil {
+				writeUnauthorized(w, challenge+`, error="invalid_token", error_description=`+quote(err.Error()))
+				return
+			}
+			principal.Scheme = "Bearer"
+			next(w, withPrincipal(req, principal))
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBearer(t *testing.T) {
+	handler := Bearer(BearerOptions{
+		Validator: ValidatorFunc(func(_ context.Context, token string) (*Principal, error) {
+			if token == "expired" {
+				return nil, errors.New(`token "expired"`)
+			}
+			return Tokens{"t0ken": "ci"}.ValidateToken(context.Background(), token)
+		}),
+	})(whoami)
+
+	// Test: Valid token reaches the handler with the validator's principal
+	res, body := serve(t, handler, "Authorization: Bearer t0ken\r\n")
+	assert.Equal(t, "Bearer ci", body)
+
+	// Test: No token gets a challenge without an error code
+	res, _ = serve(t, handler, "")
+	assert.Equal(t, 401, res.StatusCode)
+	assert.Equal(t, `Bearer realm="restricted"`, res.Header.Get("WWW-Authenticate"))
+
+	// Test: Refused tokens get invalid_token with the reason, unquoted
+	res, _ = serve(t, handler, "Authorization: Bearer expired\r\n")
+	assert.Equal(t, `Bearer realm="restricted", error="invalid_token", error_description="token expired"`,
+		res.Header.Get("WWW-Authenticate"))
+	res, _ = serve(t, handler, "Authorization: Bearer other\r\n")
+	assert.Contains(t, res.Header.Get("WWW-Authenticate"), `error_description="invalid token"`)
+
+	// Test: A validator returning no principal and no error refuses the token
+	nilHandler := Bearer(BearerOptions{Validator: ValidatorFunc(func(context.Context, string) (*Principal, error) {
+		return nil, nil
+	})})(whoami)
+	res, _ = serve(t, nilHandler, "Authorization: Bearer t0ken\r\n")
+	assert.Equal(t, 401, res.StatusCode)
+	assert.Contains(t, res.Header.Get("WWW-Authenticate"), `error_description="invalid token"`)
+
+	// Test: Token from a cookie when configured, the header taking precedence
+	handler = Bearer(BearerOptions{Validator: Tokens{"t0ken": "ci"}, Cookie: "token"})(whoami)
+	_, body = serve(t, handler, "Cookie: theme=dark; token=t0ken\r\n")
+	assert.Equal(t, "Bearer ci", body)
+	res, _ = serve(t, handler, "Authorization: Bearer other\r\nCookie: token=t0ken\r\n")
+	assert.Equal(t, 401, res.StatusCode)
+}
@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Digest algorithms from RFC 7616
+const (
+	SHA256 = "SHA-256"
+	// MD5 is broken but the only algorithm many older clients support
+	MD5 = "MD5"
+)
+
+// Digest qop values
+const (
+	QOPAuth = "auth"
+	// QOPAuthInt also protects the request body
+	QOPAuthInt = "auth-int"
+)
+
+// How long a nonce can be used before the client is asked to get a new one
+const DefaultNonceLifetime = 5 * time.Minute
+
+var errMalformed = errors.New("malformed digest credentials")
+
+// DigestSecrets provides what Digest needs to check a user's response: the
+// hash of username:realm:password with the given algorithm, as hex. Digest
+// can't work from hashes meant for storage such as bcrypt.
+type DigestSecrets interface {
+	DigestHA1(username, realm, algorithm string) (ha1 string, ok bool)
+}
+
+// DigestHA1 hashes the user's plain text password.
+func (u Users) DigestHA1(username, realm, algorithm string) (string, bool) {
+	password, ok := u[username]
+	if !ok {
+		return "", false
+	}
+	return hashHex(algorithm, username+":"+realm+":"+password), true
+}
+
+type DigestOptions struct {
+	// Realm describes the protected area to the client and is part of the
+	// hashed secret, DefaultRealm when empty
+	Realm   string
+	Secrets DigestSecrets
+	// Algorithms offered, most preferred first, SHA-256 then MD5 when empty
+	Algorithms []string
+	// QOP values offered, auth and auth-int when empty
+	QOP []string
+	// NonceLifetime is how long a nonce stays valid, DefaultNonceLifetime
+	// when zero
+	NonceLifetime time.Duration
+}
+
+// Digest requires HTTP Digest authentication as in RFC 7616. Requests
+// without valid credentials are answered with 401 Unauthorized and a
+// challenge per algorithm, others reach the handler with a Principal in their
+// context. Each nonce count can be used once, and a correct response with an
+// expired nonce gets a challenge marked stale so the client retries with a
+// new nonce without asking the user again.
+func Digest(opts DigestOptions) server.Middleware {
+	return newDigest(opts).middleware
+}
+
+type digest struct {
+	opts DigestOptions
+	// Signs nonces so they can't be forged with a later expiry
+	key    []byte
+	opaque string
+	now    func() time.Time
+
+	mu sync.Mutex
+	// Highest nonce count seen for each unexpired nonce
+	counts    map[string]uint64
+	lastSweep time.Time
+}
+
+func newDigest(opts DigestOptions) *digest {
+	if opts.Realm == "" {
+		opts.Realm = DefaultRealm
+	}
+	if len(opts.Algorithms) == 0 {
+		opts.Algorithms = []string{SHA256, MD5}
+	}
+	if len(opts.QOP) == 0 {
+		opts.QOP = []string{QOPAuth, QOPAuthInt}
+	}
+	if opts.NonceLifetime == 0 {
+		opts.NonceLifetime = DefaultNonceLifetime
+	}
+
+	d := &digest{
+		opts:   opts,
+		key:    make([]byte, 32),
+		now:    time.Now,
+		counts: map[string]uint64{},
+	}
+	rand.Read(d.key)
+	opaque := make([]byte, 16)
+	rand.Read(opaque)
+	d.opaque = hex.EncodeToString(opaque)
+	return d
+}
+
+func (d *digest) middleware(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		username, stale, ok := d.authenticate(req)
+		if !ok {
+			writeUnauthorized(w, d.challenge(stale))
+			return
+		}
+		next(w, withPrincipal(req, &Principal{Name: username, Scheme: "Digest"}))
+	}
+}
+
+// Checks the request's credentials. stale reports a correct response for
+// a nonce that has expired.
+func (d *digest) authenticate(req *request.Request) (username string, stale, ok bool) {
+	creds, ok := credentials(req, "Digest")
+	if !ok {
+		return "", false, false
+	}
+	params, err := parseParams(creds)
+	if err != nil {
+		return "", false, false
+	}
+
+	username = params["username"]
+	algorithm := params["algorithm"]
+	if algorithm == "" {
+		algorithm = MD5
+	}
+	qop := params["qop"]
+	nc, err := strconv.ParseUint(params["nc"], 16, 64)
+	if username == "" || params["realm"] != d.opts.Realm ||
+		params["uri"] != req.RequestLine.RequestTarget || params["cnonce"] == "" ||
+		params["opaque"] != "" && params["opaque"] != d.opaque ||
+		!slices.Contains(d.opts.Algorithms, algorithm) || !slices.Contains(d.opts.QOP, qop) ||
+		err != nil || len(params["nc"]) != 8 {
+		return "", false, false
+	}
+
+	nonce := params["nonce"]
+	issued, ok := d.verifyNonce(nonce)
+	if !ok {
+		return "", false, false
+	}
+
+	ha1, known := d.opts.Secrets.DigestHA1(username, d.opts.Realm, algorithm)
+	expected := digestResponse(algorithm, ha1, nonce, params["nc"], params["cnonce"], qop,
+		req.RequestLine.Method, params["uri"], req.Body)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(params["response"])) != 1 || !known {
+		return "", false, false
+	}
+
+	if d.now().Sub(issued) > d.opts.NonceLifetime {
+		return "", true, false
+	}
+	if !d.useCount(nonce, nc) {
+		return "", false, false
+	}
+	return username, false, true
+}
+
+// Records nc for nonce, refusing counts that aren't higher than the last so
+// a captured request can't be replayed
+func (d *digest) useCount(nonce string, nc uint64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	if now.Sub(d.lastSweep) > d.opts.NonceLifetime {
+		for n := range d.counts {
+			if issued, _ := d.verifyNonce(n); now.Sub(issued) > d.opts.NonceLifetime {
+				delete(d.counts, n)
+			}
+		}
+		d.lastSweep = now
+	}
+
+	if nc <= d.counts[nonce] {
+		return false
+	}
+	d.counts[nonce] = nc
+	return true
+}
+
+// One challenge per algorithm, in order of preference
+func (d *digest) challenge(stale bool) string {
+	nonce := d.newNonce()
+	challenges := make([]string, 0, len(d.opts.Algorithms))
+	for _, algorithm := range d.opts.Algorithms {
+		challenge := "Digest realm=" + quote(d.opts.Realm) +
+			", qop=" + quote(strings.Join(d.opts.QOP, ", ")) +
+			", algorithm=" + algorithm +
+			", nonce=" + quote(nonce) +
+			", opaque=" + quote(d.opaque)
+		if stale {
+			challenge += ", stale=true"
+		}
+		challenges = append(challenges, challenge)
+	}
+	return strings.Join(challenges, ", ")
+}
+
+// A nonce is the time it was issued, random bytes and a MAC of both, so it
+// can be checked and dated without being stored
+func (d *digest) newNonce() string {
+	b := make([]byte, 8+16, 8+16+sha256.Size)
+	binary.BigEndian.PutUint64(b, uint64(d.now().UnixNano()))
+	rand.Read(b[8:])
+	return base64.RawURLEncoding.EncodeToString(d.sign(b))
+}
+
+func (d *digest) sign(b []byte) []byte {
+	mac := hmac.New(sha256.New, d.key)
+	mac.Write(b)
+	return mac.Sum(b)
+}
+
+// Returns when a nonce this server issued was issued
+func (d *digest) verifyNonce(nonce string) (time.Time, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(b) != 8+16+sha256.Size {
+		return time.Time{}, false
+	}
+	if !hmac.Equal(d.sign(b[:8+16:8+16]), b) {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b))), true
+}
+
+// The response a client should send, as hex
+func digestResponse(algorithm, ha1, nonce, nc, cnonce, qop, method, uri string, body []byte) string {
+	ha2 := hashHex(algorithm, method+":"+uri)
+	if qop == QOPAuthInt {
+		ha2 = hashHex(algorithm, method+":"+uri+":"+hashHex(algorithm, string(body)))
+	}
+	return hashHex(algorithm, ha1+":"+nonce+":"+nc+":"+cnonce+":"+qop+":"+ha2)
+}
+
+func hashHex(algorithm, s string) string {
+	var h hash.Hash
+	if algorithm == SHA256 {
+		h = sha256.New()
+	} else {
+		h = md5.New()
+	}
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Parses comma separated name=value auth-params, where values are tokens or
+// quoted strings. Names are lowercased.
+func parseParams(s string) (map[string]string, error) {
+	params := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return params, nil
+		}
+
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, errMalformed
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		rest = strings.TrimLeft(rest, " \t")
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				b.WriteByte(rest[i])
+			}
+			if i == len(rest) {
+				return nil, errMalformed
+			}
+			value, s = b.String(), rest[i+1:]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end == -1 {
+				end = len(rest)
+			}
+			value, s = strings.TrimSpace(rest[:end]), rest[end:]
+		}
+
+		s = strings.TrimLeft(s, " \t")
+		if s != "" && s[0] != ',' {
+			return nil, errMalformed
+		}
+		params[name] = value
+	}
+}
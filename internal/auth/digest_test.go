@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"fmt"
+	"httpfromtcp/internal/handlertest"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestResponse(t *testing.T) {
+	// Test: Examples from RFC 7616 section 3.9.1
+	const realm = "http-auth@example.org"
+	users := Users{"Mufasa": "Circle of Life"}
+	nonce := "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v"
+	cnonce := "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+
+	ha1, _ := users.DigestHA1("Mufasa", realm, SHA256)
+	assert.Equal(t, "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+		digestResponse(SHA256, ha1, nonce, "00000001", cnonce, QOPAuth, "GET", "/dir/index.html", nil))
+	ha1, _ = users.DigestHA1("Mufasa", realm, MD5)
+	assert.Equal(t, "8ca523f5e9506fed4657c9700eebdbec",
+		digestResponse(MD5, ha1, nonce, "00000001", cnonce, QOPAuth, "GET", "/dir/index.html", nil))
+}
+
+var nonceParam = regexp.MustCompile(`nonce="([^"]+)"`)
+
+func TestDigest(t *testing.T) {
+	users := Users{"Mufasa": "Circle of Life"}
+	d := newDigest(DigestOptions{Realm: "example", Secrets: users})
+	now := time.Now()
+	d.now = func() time.Time { return now }
+	handler := d.middleware(whoami)
+
+	authorization := func(username, password, algorithm, nonce, nc, qop, method, uri, body string) string {
+		ha1, _ := Users{username: password}.DigestHA1(username, "example", algorithm)
+		resp := digestResponse(algorithm, ha1, nonce, nc, "0a4f113b", qop, method, uri, []byte(body))
+		return fmt.Sprintf(`Authorization: Digest username="%s", realm="example", nonce="%s", uri="%s", `+
+			`algorithm=%s, qop=%s, nc=%s, cnonce="0a4f113b", response="%s", opaque="%s"`+"\r\n",
+			username, nonce, uri, algorithm, qop, nc, resp, d.opaque)
+	}
+	send := func(method, auth, body string) (*http.Response, string) {
+		return handlertest.Serve(t, handler, handlertest.NewRequest(t, method, "/dir/index.html", auth, body))
+	}
+	// The status and challenge of a GET
+	get := func(auth string) (int, string) {
+		res, _ := send("GET", auth, "")
+		return res.StatusCode, res.Header.Get("WWW-Authenticate")
+	}
+
+	// Test: No credentials get a challenge per algorithm, SHA-256 first
+	status, challenge := get("")
+	assert.Equal(t, 401, status)
+	assert.Regexp(t, `^Digest realm="example", qop="auth, auth-int", algorithm=SHA-256, `+
+		`nonce="[^"]+", opaque="[0-9a-f]+", Digest realm="example", qop="auth, auth-int", algorithm=MD5, `, challenge)
+	assert.NotContains(t, challenge, "stale")
+	nonce := nonceParam.FindStringSubmatch(challenge)[1]
+
+	// Test: Correct response reaches the handler with a principal
+	_, body := send("GET", authorization("Mufasa", "Circle of Life", SHA256, nonce, "00000001", QOPAuth, "GET", "/dir/index.html", ""), "")
+	assert.Equal(t, "Digest Mufasa", body)
+
+	// Test: Replayed nonce counts are refused, higher ones accepted
+	status, _ = get(authorization("Mufasa", "Circle of Life", SHA256, nonce, "00000001", QOPAuth, "GET", "/dir/index.html", ""))
+	assert.Equal(t, 401, status)
+	status, _ = get(authorization("Mufasa", "Circle of Life", MD5, nonce, "00000002", QOPAuth, "GET", "/dir/index.html", ""))
+	assert.Equal(t, 200, status)
+
+	// Test: auth-int covers the body
+	res, _ := send("POST", authorization("Mufasa", "Circle of Life", SHA256, nonce, "00000003", QOPAuthInt, "POST", "/dir/index.html", "a=1"), "a=1")
+	assert.Equal(t, 200, res.StatusCode)
+	res, _ = send("POST", authorization("Mufasa", "Circle of Life", SHA256, nonce, "00000004", QOPAuthInt, "POST", "/dir/index.html", "a=1"), "a=2")
+	assert.Equal(t, 401, res.StatusCode)
+
+	// Test: Wrong password, user, URI, and forged nonces are refused
+	for _, auth := range []string{
+		authorization("Mufasa", "wrong", SHA256, nonce, "00000010", QOPAuth, "GET", "/dir/index.html", ""),
+		authorization("Scar", "Circle of Life", SHA256, nonce, "00000011", QOPAuth, "GET", "/dir/index.html", ""),
+		authorization("Mufasa", "Circle of Life", SHA256, nonce, "00000012", QOPAuth, "GET", "/other", ""),
+		authorization("Mufasa", "Circle of Life", SHA256, "7ypf/xlj9XXwfDPEoM4URrv", "00000013", QOPAuth, "GET", "/dir/index.html", ""),
+		"Authorization: Digest username=\"Mufasa\", realm=\"unterminated\r\n",
+	} {
+		status, challenge := get(auth)
+		assert.Equal(t, 401, status, auth)
+		assert.NotContains(t, challenge, "stale")
+	}
+
+	// Test: Expired nonce with a correct response is stale, a wrong one isn't
+	now = now.Add(DefaultNonceLifetime + time.Second)
+	_, challenge = get(authorization("Mufasa", "wrong", SHA256, nonce, "00000020", QOPAuth, "GET", "/dir/index.html", ""))
+	assert.NotContains(t, challenge, "stale")
+	status, challenge = get(authorization("Mufasa", "Circle of Life", SHA256, nonce, "00000021", QOPAuth, "GET", "/dir/index.html", ""))
+	assert.Equal(t, 401, status)
+	assert.Contains(t, challenge, "stale=true")
+
+	// Test: The renewed nonce works, and expired nonce counts were swept
+	fresh := nonceParam.FindStringSubmatch(challenge)[1]
+	assert.NotEqual(t, nonce, fresh)
+	status, _ = get(authorization("Mufasa", "Circle of Life", SHA256, fresh, "00000001", QOPAuth, "GET", "/dir/index.html", ""))
+	assert.Equal(t, 200, status)
+	assert.NotContains(t, d.counts, nonce)
+}
+
+func TestParseParams(t *testing.T) {
+	// Test: Tokens, quoted strings with escapes, and case-insensitive names
+	params, err := parseParams(`Username="Mu\"fasa", qop=auth,nc=00000001 , uri="/a,b"`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"username": `Mu"fasa`, "qop": "auth", "nc": "00000001", "uri": "/a,b"}, params)
+
+	// Test: Missing values, unterminated quotes and junk after a value
+	for _, s := range []string{`username`, `username="x`, `username="x" y, qop=auth`} {
+		_, err := parseParams(s)
+		assert.ErrorIs(t, err, errMalformed, s)
+	}
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Htpasswd is a CredentialChecker backed by an Apache htpasswd file, as
+// written by htpasswd -B. Only bcrypt hashes are supported since the other
+// formats are too weak to use.
+type Htpasswd struct {
+	hashes map[string][]byte
+	// Compared against for unknown users so they take as long as known ones
+	dummyHash []byte
+}
+
+// LoadHtpasswd reads an htpasswd file.
+func LoadHtpasswd(path string) (*Htpasswd, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseHtpasswd(f)
+}
+
+// ParseHtpasswd reads htpasswd lines of username:hash. Blank lines and lines
+// starting with # are skipped.
+func ParseHtpasswd(r io.Reader) (*Htpasswd, error) {
+	h := &Htpasswd{hashes: map[string][]byte{}}
+	cost := bcrypt.MinCost
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		username, hash, ok := strings.Cut(text, ":")
+		if !ok || username == "" {
+			return nil, fmt.Errorf("htpasswd line %d: expected username:hash", line)
+		}
+		if !strings.HasPrefix(hash, "$2a$") && !strings.HasPrefix(hash, "$2b$") && !strings.HasPrefix(hash, "$2y$") {
+			return nil, fmt.Errorf("htpasswd line %d: only bcrypt hashes are supported", line)
+		}
+		hashCost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return nil, fmt.Errorf("htpasswd line %d: %w", line, err)
+		}
+		cost = max(cost, hashCost)
+		h.hashes[username] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	h.dummyHash, err = bcrypt.GenerateFromPassword([]byte("dummy password"), cost)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Htpasswd) CheckCredentials(username, password string) bool {
+	hash, ok := h.hashes[username]
+	if !ok {
+		hash = h.dummyHash
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil && ok
+}
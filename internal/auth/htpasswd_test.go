@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	require.NoError(t, err)
+	// htpasswd -B writes the $2y$ variant
+	apacheHash := "$2y$" + strings.TrimPrefix(string(hash), "$2a$")
+	path := filepath.Join(t.TempDir(), ".htpasswd")
+	require.NoError(t, os.WriteFile(path, []byte("# users\n\nalice:"+apacheHash+"\nbob:"+string(hash)+"\n"), 0o600))
+
+	// Test: bcrypt hashes are checked
+	h, err := LoadHtpasswd(path)
+	require.NoError(t, err)
+	assert.True(t, h.CheckCredentials("alice", "hunter2"))
+	assert.True(t, h.CheckCredentials("bob", "hunter2"))
+	assert.False(t, h.CheckCredentials("alice", "hunter3"))
+	assert.False(t, h.CheckCredentials("carol", "hunter2"))
+
+	// Test: Weak hash formats and malformed lines are refused
+	_, err = ParseHtpasswd(strings.NewReader("alice:$apr1$abc$def\n"))
+	assert.ErrorContains(t, err, "line 1: only bcrypt")
+	_, err = ParseHtpasswd(strings.NewReader("alice:" + string(hash) + "\nbob\n"))
+	assert.ErrorContains(t, err, "line 2: expected username:hash")
+
+	_, err = LoadHtpasswd(filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
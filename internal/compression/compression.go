@@ -0,0 +1,216 @@
+package compression
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Responses with a known length below this many bytes aren't worth compressing
+const DefaultMinSize = 1024
+
+// Supported content codings in order of preference
+var encodings = []string{"gzip", "deflate"}
+
+// Content types that are already compressed and would only grow
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/wasm",
+}
+
+type Options struct {
+	// Compression level passed to the encoder, zero selects the default
+	Level int
+	// Responses with a Content-Length below this are sent uncompressed, zero
+	// selects DefaultMinSize
+	MinSize int
+}
+
+// Middleware compresses response bodies with the best content coding the
+// client accepts. Compressed responses drop Content-Length and are sent with
+// chunked framing since their final length isn't known up front.
+func Middleware(opts Options) server.Middleware {
+	if opts.Level == 0 {
+		opts.Level = gzip.DefaultCompression
+	}
+	if opts.MinSize == 0 {
+		opts.MinSize = DefaultMinSize
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			encoding := ""
+			if accept, ok := req.Headers.Get("Accept-Encoding"); ok {
+				encoding = negotiate(accept)
+			}
+
+			w.AddFilter(&filter{
+				encoding: encoding,
+				head:     req.RequestLine.Method == "HEAD",
+				opts:     opts,
+			})
+			next(w, req)
+		}
+	}
+}
+
+type filter struct {
+	encoding string
+	head     bool
+	opts     Options
+	active   bool
+}
+
+func (f *filter) Headers(statusCode response.StatusCode, h headers.Headers) {
+	if !compressible(statusCode, h) {
+		return
+	}
+
+	// The body depends on Accept-Encoding whether or not this client got it
+	// compressed, so caches must key on it
+	h.AddVary("Accept-Encoding")
+
+	if f.encoding == "" || f.head {
+		return
+	}
+	if cl, ok := h.Get("Content-Length"); ok {
+		n, err := strconv.Atoi(cl)
+		if err == nil && n < f.opts.MinSize {
+			return
+		}
+	}
+
+	h.Remove("Content-Length")
+	h.Replace("Content-Encoding", f.encoding)
+	if te, _ := h.Get("Transfer-Encoding"); !strings.Contains(strings.ToLower(te), "chunked") {
+		h.Replace("Transfer-Encoding", "chunked")
+	}
+
+	// The encoded bytes differ from the identity representation so a strong
+	// entity tag no longer describes them
+	if etag, ok := h.Get("ETag"); ok && !strings.HasPrefix(etag, "W/") {
+		h.Replace("ETag", "W/"+etag)
+	}
+
+	f.active = true
+}
+
+func (f *filter) Body(w io.Writer) io.WriteCloser {
+	if !f.active {
+		return nil
+	}
+
+	switch f.encoding {
+	case "gzip":
+		enc, _ := gzip.NewWriterLevel(w, f.opts.Level)
+		return &flushWriter{enc: enc}
+	case "deflate":
+		enc, _ := zlib.NewWriterLevel(w, f.opts.Level)
+		return &flushWriter{enc: enc}
+	}
+	return nil
+}
+
+// Flushes the encoder after every write so streamed responses still reach
+// the client as the handler produces them
+type flushWriter struct {
+	enc interface {
+		io.WriteCloser
+		Flush() error
+	}
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.enc.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, fw.enc.Flush()
+}
+
+func (fw *flushWriter) Close() error {
+	return fw.enc.Close()
+}
+
+func compressible(statusCode response.StatusCode, h headers.Headers) bool {
+	// Bodyless responses and partial content, whose ranges refer to the
+	// identity representation, are left alone
+	if statusCode < 200 || statusCode == 204 || statusCode == 304 || statusCode == response.StatusPartialContent {
+		return false
+	}
+	if _, ok := h.Get("Content-Range"); ok {
+		return false
+	}
+	if ce, ok := h.Get("Content-Encoding"); ok && ce != "identity" {
+		return false
+	}
+
+	contentType, _ := h.Get("Content-Type")
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) && !strings.HasPrefix(contentType, "image/svg") {
+			return false
+		}
+	}
+	return true
+}
+
+// Pick the supported content coding with the highest q-value in an
+// Accept-Encoding header, preferring the order of encodings on ties. An
+// empty result means the body should be sent as is.
+func negotiate(accept string) string {
+	qvalues := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.ToLower(strings.TrimSpace(name)) != "q" {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || v < 0 || v > 1 {
+				v = 0
+			}
+			q = v
+		}
+		qvalues[coding] = q
+	}
+
+	best := ""
+	bestQ := 0.0
+	for _, encoding := range encodings {
+		q, ok := qvalues[encoding]
+		if !ok {
+			// A wildcard covers any coding not listed explicitly
+			q = qvalues["*"]
+		}
+		if q > bestQ {
+			best = encoding
+			bestQ = q
+		}
+	}
+	return best
+}
@@ -0,0 +1,155 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"httpfromtcp/internal/handlertest"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var largeBody = strings.Repeat("all work and no play makes jack a dull boy\n", 100)
+
+func TestNegotiate(t *testing.T) {
+	// Test: Single supported coding
+	assert.Equal(t, "gzip", negotiate("gzip"))
+	assert.Equal(t, "deflate", negotiate("deflate"))
+
+	// Test: Highest q-value wins
+	assert.Equal(t, "deflate", negotiate("gzip;q=0.5, deflate;q=0.8"))
+	assert.Equal(t, "gzip", negotiate("br, gzip;q=0.9, deflate;q=0.1"))
+
+	// Test: Ties are broken by server preference
+	assert.Equal(t, "gzip", negotiate("deflate, gzip"))
+
+	// Test: Wildcard and explicit refusal
+	assert.Equal(t, "gzip", negotiate("*"))
+	assert.Equal(t, "deflate", negotiate("gzip;q=0, *;q=0.5"))
+	assert.Equal(t, "", negotiate("gzip;q=0, deflate;q=0"))
+
+	// Test: Unsupported or empty
+	assert.Equal(t, "", negotiate("br, zstd"))
+	assert.Equal(t, "", negotiate(""))
+	assert.Equal(t, "", negotiate("identity"))
+}
+
+func TestMiddleware(t *testing.T) {
+	h := server.Chain(textHandler(largeBody), Middleware(Options{}))
+
+	// Test: gzip
+	res, body := serve(t, h, "GET", "Accept-Encoding: gzip")
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", res.Header.Get("Vary"))
+	assert.Equal(t, []string{"chunked"}, res.TransferEncoding)
+	assert.Equal(t, "W/\"v1\"", res.Header.Get("ETag"))
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, largeBody, string(data))
+	assert.Less(t, len(body), len(largeBody))
+
+	// Test: deflate
+	res, body = serve(t, h, "GET", "Accept-Encoding: deflate")
+	assert.Equal(t, "deflate", res.Header.Get("Content-Encoding"))
+	zr2, err := zlib.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	data, err = io.ReadAll(zr2)
+	require.NoError(t, err)
+	assert.Equal(t, largeBody, string(data))
+
+	// Test: Client without Accept-Encoding
+	res, body = serve(t, h, "GET", "")
+	assert.Equal(t, "", res.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", res.Header.Get("Vary"))
+	assert.Equal(t, largeBody, string(body))
+
+	// Test: HEAD isn't compressed
+	res, _ = serve(t, h, "HEAD", "Accept-Encoding: gzip")
+	assert.Equal(t, "", res.Header.Get("Content-Encoding"))
+
+	// Test: Small bodies are sent as is
+	h = server.Chain(textHandler("tiny"), Middleware(Options{}))
+	res, body = serve(t, h, "GET", "Accept-Encoding: gzip")
+	assert.Equal(t, "", res.Header.Get("Content-Encoding"))
+	assert.Equal(t, "tiny", string(body))
+
+	// Test: Already compressed content types are skipped
+	h = server.Chain(func(w *response.Writer, _ *request.Request) {
+		headers := response.GetDefaultHeaders(len(largeBody))
+		headers.Replace("Content-Type", "image/png")
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(headers)
+		w.WriteBody([]byte(largeBody))
+	}, Middleware(Options{}))
+	res, body = serve(t, h, "GET", "Accept-Encoding: gzip")
+	assert.Equal(t, "", res.Header.Get("Content-Encoding"))
+	assert.Equal(t, "", res.Header.Get("Vary"))
+	assert.Equal(t, largeBody, string(body))
+}
+
+func TestMiddlewareComposition(t *testing.T) {
+	// Test: Chunked body with trailers
+	h := server.Chain(func(w *response.Writer, _ *request.Request) {
+		headers := response.GetDefaultHeaders(0)
+		headers.Remove("Content-Length")
+		headers.Set("Transfer-Encoding", "chunked")
+		headers.Set("Trailer", "X-Checksum")
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(headers)
+		w.WriteChunkedBody([]byte(largeBody[:100]))
+		w.WriteChunkedBody([]byte(largeBody[100:]))
+		headers.Set("X-Checksum", "abc")
+		w.WriteTrailers(headers)
+	}, Middleware(Options{}))
+	res, body := serve(t, h, "GET", "Accept-Encoding: gzip")
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	assert.Equal(t, "abc", res.Trailer.Get("X-Checksum"))
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, largeBody, string(data))
+
+	// Test: Range responses keep the identity coding
+	h = server.Chain(func(w *response.Writer, req *request.Request) {
+		response.ServeContent(w, req, "file.txt", time.Time{}, strings.NewReader(largeBody), nil)
+	}, Middleware(Options{}))
+	res, body = serve(t, h, "GET", "Accept-Encoding: gzip\r\nRange: bytes=0-9")
+	assert.Equal(t, 206, res.StatusCode)
+	assert.Equal(t, "", res.Header.Get("Content-Encoding"))
+	assert.Equal(t, largeBody[:10], string(body))
+	res, _ = serve(t, h, "GET", "Accept-Encoding: gzip")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+}
+
+func textHandler(body string) server.Handler {
+	return func(w *response.Writer, _ *request.Request) {
+		headers := response.GetDefaultHeaders(len(body))
+		headers.Set("ETag", "\"v1\"")
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(headers)
+		w.WriteBody([]byte(body))
+	}
+}
+
+func serve(t *testing.T, h server.Handler, method, reqHeaders string) (*http.Response, []byte) {
+	t.Helper()
+
+	if reqHeaders != "" {
+		reqHeaders += "\r\n"
+	}
+	res, body := handlertest.Serve(t, h, handlertest.NewRequest(t, method, "/", reqHeaders, ""))
+	return res, []byte(body)
+}
@@ -0,0 +1,129 @@
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Default cap on the size of a decompressed request body
+const DefaultMaxDecodedSize = 10 << 20
+
+var errTooLarge = errors.New("decoded body too large")
+
+type DecodeOptions struct {
+	// Requests whose decoded body exceeds this many bytes are rejected with
+	// 413, zero selects DefaultMaxDecodedSize
+	MaxDecodedSize int64
+}
+
+// DecodeRequest transparently decompresses request bodies sent with a gzip
+// or deflate Content-Encoding. Handlers see the decoded body with the
+// Content-Encoding header removed and Content-Length updated. Unknown
+// codings are answered with 415 and bodies that decode past the size cap,
+// such as zip bombs, with 413.
+func DecodeRequest(opts DecodeOptions) server.Middleware {
+	if opts.MaxDecodedSize == 0 {
+		opts.MaxDecodedSize = DefaultMaxDecodedSize
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			value, ok := req.Headers.Get("Content-Encoding")
+			if !ok {
+				next(w, req)
+				return
+			}
+
+			// Codings are listed in the order they were applied
+			body := req.Body
+			codings := strings.Split(value, ",")
+			for i := len(codings) - 1; i >= 0; i-- {
+				coding := strings.ToLower(strings.TrimSpace(codings[i]))
+
+				var err error
+				switch coding {
+				case "", "identity":
+					continue
+				case "gzip", "x-gzip", "deflate":
+					body, err = decode(coding, body, opts.MaxDecodedSize)
+				default:
+					writeDecodeError(w, response.StatusUnsupportedMediaType, "unsupported content encoding: "+coding)
+					return
+				}
+
+				if errors.Is(err, errTooLarge) {
+					writeDecodeError(w, response.StatusPayloadTooLarge, "decoded request body exceeds limit")
+					return
+				}
+				if err != nil {
+					writeDecodeError(w, response.StatusBadRequest, "invalid "+coding+" request body")
+					return
+				}
+			}
+
+			req.Body = body
+			req.ContentLength = len(body)
+			req.Headers.Remove("Content-Encoding")
+			if _, ok := req.Headers.Get("Content-Length"); ok {
+				req.Headers.Replace("Content-Length", strconv.Itoa(len(body)))
+			}
+			next(w, req)
+		}
+	}
+}
+
+func decode(coding string, body []byte, limit int64) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+
+	switch coding {
+	case "gzip", "x-gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		// deflate is meant to be zlib wrapped but some clients send raw
+		// deflate data, so fall back when there's no zlib header
+		r, err = zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			r, err = flate.NewReader(bytes.NewReader(body)), nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// Read one byte past the limit to tell a body of exactly the limit apart
+	// from one that's too large
+	decoded, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decoded)) > limit {
+		return nil, errTooLarge
+	}
+
+	return decoded, nil
+}
+
+func writeDecodeError(w *response.Writer, status response.StatusCode, message string) {
+	body := []byte(fmt.Sprintf("%d %s: %s\n", status, response.StatusText(status), message))
+	headers := response.GetDefaultHeaders(len(body))
+	if status == response.StatusUnsupportedMediaType {
+		// Tell the client which codings it may use instead
+		headers.Set("Accept-Encoding", "gzip, deflate")
+	}
+
+	w.WriteStatusLine(status)
+	w.WriteHeaders(headers)
+	w.WriteBody(body)
+}
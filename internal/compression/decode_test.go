@@ -0,0 +1,94 @@
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"httpfromtcp/internal/handlertest"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeRequest(t *testing.T) {
+	payload := []byte(`{"metric":"cpu","value":0.42}`)
+
+	// Test: gzip body is decoded
+	status, req := decodeRequest(t, "gzip", gzipBytes(t, payload), DecodeOptions{})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, payload, req.Body)
+	assert.Equal(t, len(payload), req.ContentLength)
+	_, ok := req.Headers.Get("Content-Encoding")
+	assert.False(t, ok)
+	cl, _ := req.Headers.Get("Content-Length")
+	assert.Equal(t, strconv.Itoa(len(payload)), cl)
+
+	// Test: zlib and raw deflate bodies are decoded
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	zw.Write(payload)
+	zw.Close()
+	status, req = decodeRequest(t, "deflate", zbuf.Bytes(), DecodeOptions{})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, payload, req.Body)
+
+	var fbuf bytes.Buffer
+	fw, _ := flate.NewWriter(&fbuf, flate.DefaultCompression)
+	fw.Write(payload)
+	fw.Close()
+	status, req = decodeRequest(t, "deflate", fbuf.Bytes(), DecodeOptions{})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, payload, req.Body)
+
+	// Test: Stacked codings are removed in reverse order
+	status, req = decodeRequest(t, "gzip, identity, gzip", gzipBytes(t, gzipBytes(t, payload)), DecodeOptions{})
+	assert.Equal(t, 200, status)
+	assert.Equal(t, payload, req.Body)
+
+	// Test: Unknown coding
+	status, _ = decodeRequest(t, "br", payload, DecodeOptions{})
+	assert.Equal(t, 415, status)
+
+	// Test: Corrupt body
+	status, _ = decodeRequest(t, "gzip", payload, DecodeOptions{})
+	assert.Equal(t, 400, status)
+
+	// Test: Decoded size over the cap
+	bomb := gzipBytes(t, make([]byte, 1<<20))
+	status, _ = decodeRequest(t, "gzip", bomb, DecodeOptions{MaxDecodedSize: 1 << 16})
+	assert.Equal(t, 413, status)
+	status, _ = decodeRequest(t, "gzip", bomb, DecodeOptions{MaxDecodedSize: 1 << 20})
+	assert.Equal(t, 200, status)
+}
+
+func decodeRequest(t *testing.T, encoding string, body []byte, opts DecodeOptions) (int, *request.Request) {
+	t.Helper()
+
+	req := handlertest.NewRequest(t, "POST", "/ingest", "Content-Encoding: "+encoding+"\r\n", string(body))
+
+	var seen *request.Request
+	h := DecodeRequest(opts)(func(w *response.Writer, req *request.Request) {
+		seen = req
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	})
+
+	res, _ := handlertest.Serve(t, h, req)
+	return res.StatusCode, seen
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
@@ -0,0 +1,229 @@
+package cookie
+
+import (
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits from RFC 6265bis that browsers enforce by dropping the cookie
+const (
+	maxNameValueSize  = 4096
+	maxAttributeValue = 1024
+)
+
+// The HTTP date format, which Expires uses
+const expiresFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+var (
+	ErrInvalidName  = errors.New("invalid cookie name")
+	ErrInvalidValue = errors.New("invalid cookie value")
+	ErrTooLarge     = errors.New("cookie too large")
+	// Secure is required by SameSite=None, Partitioned and the __Secure- and
+	// __Host- name prefixes
+	ErrNotSecure = errors.New("cookie must be Secure")
+	// __Host- cookies must have Path=/ and no Domain
+	ErrHostPrefix     = errors.New("__Host- cookie must have Path=/ and no Domain")
+	ErrInvalidDomain  = errors.New("invalid cookie domain")
+	ErrInvalidPath    = errors.New("invalid cookie path")
+	ErrInvalidExpires = errors.New("invalid cookie expiry")
+)
+
+// SameSite controls whether a cookie is sent with cross-site requests.
+type SameSite int
+
+const (
+	// SameSiteDefault leaves the attribute out, so browsers apply their
+	// default, Lax in most of them
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+func (s SameSite) String() string {
+	switch s {
+	case SameSiteLax:
+		return "Lax"
+	case SameSiteStrict:
+		return "Strict"
+	case SameSiteNone:
+		return "None"
+	}
+	return ""
+}
+
+// Cookie is a cookie sent in a Set-Cookie header, or, with only Name and
+// Value set, one received in a Cookie header.
+type Cookie struct {
+	Name  string
+	Value string
+
+	Path   string
+	Domain string
+	// Expires is left out when zero
+	Expires time.Time
+	// MaxAge in seconds is left out when zero. Negative values delete the
+	// cookie, sent as Max-Age=0.
+	MaxAge      int
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+// Valid reports why the cookie would be rejected by browsers, or nil.
+func (c *Cookie) Valid() error {
+	if !isToken(c.Name) {
+		return ErrInvalidName
+	}
+	if !validValue(c.Value) {
+		return ErrInvalidValue
+	}
+	if len(c.Name)+len(c.Value) > maxNameValueSize {
+		return ErrTooLarge
+	}
+	if c.Path != "" && (len(c.Path) > maxAttributeValue || !validAttribute(c.Path)) {
+		return ErrInvalidPath
+	}
+	if c.Domain != "" && !validDomain(c.Domain) {
+		return ErrInvalidDomain
+	}
+	if !c.Expires.IsZero() && c.Expires.Year() < 1601 {
+		return ErrInvalidExpires
+	}
+
+	lower := strings.ToLower(c.Name)
+	needsSecure := c.SameSite == SameSiteNone || c.Partitioned ||
+		strings.HasPrefix(lower, "__secure-") || strings.HasPrefix(lower, "__host-")
+	if needsSecure && !c.Secure {
+		return ErrNotSecure
+	}
+	if strings.HasPrefix(lower, "__host-") && (c.Path != "/" || c.Domain != "") {
+		return ErrHostPrefix
+	}
+	return nil
+}
+
+// String formats the cookie as a Set-Cookie value. It doesn't validate the
+// cookie, see Valid.
+func (c *Cookie) String() string {
+	var b strings.Builder
+	b.WriteString(c.Name + "=" + c.Value)
+	if c.Path != "" {
+		b.WriteString("; Path=" + c.Path)
+	}
+	if c.Domain != "" {
+		// A leading dot is ignored by browsers and not allowed by the spec
+		b.WriteString("; Domain=" + strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=" + c.Expires.UTC().Format(expiresFormat))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	if c.SameSite != SameSiteDefault {
+		b.WriteString("; SameSite=" + c.SameSite.String())
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	return b.String()
+}
+
+// Set adds a Set-Cookie header for c to the response headers h, after any
+// already there.
+func Set(h headers.Headers, c *Cookie) error {
+	if err := c.Valid(); err != nil {
+		return fmt.Errorf("cookie %q: %w", c.Name, err)
+	}
+	h.Set("Set-Cookie", c.String())
+	return nil
+}
+
+// Parse parses a Cookie request header into its cookies, in order. Malformed
+// pairs are skipped and quotes around values removed.
+func Parse(header string) []*Cookie {
+	var cookies []*Cookie
+	for pair := range strings.SplitSeq(header, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !isToken(name) {
+			continue
+		}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		if !validValue(value) {
+			continue
+		}
+		cookies = append(cookies, &Cookie{Name: name, Value: value})
+	}
+	return cookies
+}
+
+// A token as in RFC 9110, which cookie names must be
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`()<>@,;:\"/[]?={}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// cookie-octets, optionally in double quotes
+func validValue(s string) bool {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	for _, c := range []byte(s) {
+		if c <= ' ' || c >= 0x7f || c == '"' || c == ',' || c == ';' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// Any printable characters but the attribute separator
+func validAttribute(s string) bool {
+	for _, c := range []byte(s) {
+		if c < ' ' || c >= 0x7f || c == ';' {
+			return false
+		}
+	}
+	return true
+}
+
+// Letters, digits, hyphens and dots, with an optional leading dot
+func validDomain(s string) bool {
+	s = strings.TrimPrefix(s, ".")
+	if s == "" || len(s) > 253 || strings.HasPrefix(s, ".") || strings.HasSuffix(s, ".") {
+		return false
+	}
+	for label := range strings.SplitSeq(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range []byte(label) {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
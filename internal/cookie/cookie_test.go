@@ -0,0 +1,91 @@
+package cookie
+
+import (
+	"httpfromtcp/internal/headers"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestString(t *testing.T) {
+	// Test: Every attribute, in a fixed order
+	c := &Cookie{
+		Name:        "session",
+		Value:       "abc123",
+		Path:        "/",
+		Domain:      ".example.com",
+		Expires:     time.Date(2030, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600)),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteNone,
+		Partitioned: true,
+	}
+	require.NoError(t, c.Valid())
+	assert.Equal(t, "session=abc123; Path=/; Domain=example.com; Expires=Wed, 02 Jan 2030 02:04:05 GMT; "+
+		"Max-Age=3600; Secure; HttpOnly; SameSite=None; Partitioned", c.String())
+
+	// Test: Minimal cookie, and deletion with Max-Age=0
+	assert.Equal(t, "theme=dark", (&Cookie{Name: "theme", Value: "dark"}).String())
+	assert.Equal(t, "theme=; Max-Age=0", (&Cookie{Name: "theme", MaxAge: -1}).String())
+	assert.Equal(t, "q=\"a b\"", (&Cookie{Name: "q", Value: `"a b"`}).String())
+}
+
+func TestValid(t *testing.T) {
+	for _, tc := range []struct {
+		cookie Cookie
+		err    error
+	}{
+		{Cookie{Name: "", Value: "x"}, ErrInvalidName},
+		{Cookie{Name: "a b", Value: "x"}, ErrInvalidName},
+		{Cookie{Name: "a=b", Value: "x"}, ErrInvalidName},
+		{Cookie{Name: "a", Value: "x;y"}, ErrInvalidValue},
+		{Cookie{Name: "a", Value: "x y"}, ErrInvalidValue},
+		{Cookie{Name: "a", Value: "x\r\nSet-Cookie: evil=1"}, ErrInvalidValue},
+		{Cookie{Name: "a", Value: strings.Repeat("x", 4096)}, ErrTooLarge},
+		{Cookie{Name: "a", Path: "/x;Domain=evil"}, ErrInvalidPath},
+		{Cookie{Name: "a", Domain: "exa mple.com"}, ErrInvalidDomain},
+		{Cookie{Name: "a", Domain: "-example.com"}, ErrInvalidDomain},
+		{Cookie{Name: "a", Expires: time.Date(1600, 1, 1, 0, 0, 0, 0, time.UTC)}, ErrInvalidExpires},
+		{Cookie{Name: "a", SameSite: SameSiteNone}, ErrNotSecure},
+		{Cookie{Name: "a", Partitioned: true}, ErrNotSecure},
+		{Cookie{Name: "__Secure-a"}, ErrNotSecure},
+		{Cookie{Name: "__Host-a", Secure: true}, ErrHostPrefix},
+		{Cookie{Name: "__Host-a", Secure: true, Path: "/", Domain: "example.com"}, ErrHostPrefix},
+		{Cookie{Name: "__Host-a", Secure: true, Path: "/"}, nil},
+		{Cookie{Name: "a", Value: `"quoted"`, Domain: "sub.example.com", Path: "/app"}, nil},
+	} {
+		assert.ErrorIs(t, tc.cookie.Valid(), tc.err, tc.cookie.Name)
+		if tc.err == nil {
+			assert.NoError(t, tc.cookie.Valid())
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	h := headers.Headers{}
+
+	// Test: Each cookie is kept as a separate value
+	require.NoError(t, Set(h, &Cookie{Name: "a", Value: "1", HttpOnly: true}))
+	require.NoError(t, Set(h, &Cookie{Name: "b", Value: "2", Expires: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}))
+	assert.Equal(t, []string{"a=1; HttpOnly", "b=2; Expires=Tue, 01 Jan 2030 00:00:00 GMT"}, h.Values("Set-Cookie"))
+
+	// Test: Invalid cookies aren't set
+	err := Set(h, &Cookie{Name: "c", Value: "x;y"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	assert.Len(t, h.Values("Set-Cookie"), 2)
+}
+
+func TestParse(t *testing.T) {
+	// Test: Pairs in order, quotes removed, malformed pairs skipped
+	cookies := Parse(`theme=dark; session="abc123";  empty=; bad pair=1; noequals; lang=en`)
+	var pairs []string
+	for _, c := range cookies {
+		pairs = append(pairs, c.Name+"="+c.Value)
+	}
+	assert.Equal(t, []string{"theme=dark", "session=abc123", "empty=", "lang=en"}, pairs)
+	assert.Empty(t, Parse(""))
+}
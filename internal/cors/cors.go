@@ -0,0 +1,185 @@
+package cors
+
+import (
+	"errors"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Methods allowed unless Options.AllowedMethods is given, the ones a
+// browser sends cross-origin without a preflight
+var DefaultMethods = []string{"GET", "HEAD", "POST"}
+
+// ErrCredentialsWithAnyOrigin means Options combine AllowCredentials with
+// the * origin.
+var ErrCredentialsWithAnyOrigin = errors.New("cors: AllowCredentials can't be used with the * origin")
+
+type Options struct {
+	// AllowedOrigins lists origins such as https://app.example.com. An entry
+	// of * allows any origin and https://*.example.com allows any subdomain.
+	AllowedOrigins []string
+	// AllowOriginFunc allows origins AllowedOrigins doesn't, when set
+	AllowOriginFunc func(origin string) bool
+	// AllowedMethods for cross-origin requests, DefaultMethods when empty
+	AllowedMethods []string
+	// AllowedHeaders clients may send beyond the safelisted ones. An entry of
+	// * allows any header.
+	AllowedHeaders []string
+	// ExposedHeaders the browser lets scripts read beyond the safelisted ones
+	ExposedHeaders []string
+	// AllowCredentials lets cookies and Authorization headers be sent.
+	// Matching origins are then echoed rather than answered with *. It can't
+	// be combined with an AllowedOrigins entry of *, which would give every
+	// site access to the user's session.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight result, zero to leave
+	// it to the browser
+	MaxAge time.Duration
+}
+
+// Middleware answers CORS preflight requests itself with 204 No Content and
+// adds the Access-Control-* headers to responses for allowed origins. Every
+// response whose headers depend on the origin gets Vary: Origin, so caches
+// don't serve one origin's response to another.
+// It fails with ErrCredentialsWithAnyOrigin if AllowCredentials is combined
+// with the * origin.
+func Middleware(opts Options) (server.Middleware, error) {
+	if opts.AllowCredentials && slices.Contains(opts.AllowedOrigins, "*") {
+		return nil, ErrCredentialsWithAnyOrigin
+	}
+	if len(opts.AllowedMethods) == 0 {
+		opts.AllowedMethods = DefaultMethods
+	}
+	c := &cors{opts: opts}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			origin, hasOrigin := req.Headers.Get("Origin")
+			requestMethod, isPreflight := req.Headers.Get("Access-Control-Request-Method")
+			if hasOrigin && isPreflight && req.RequestLine.Method == "OPTIONS" {
+				c.preflight(w, req, origin, requestMethod)
+				return
+			}
+
+			w.AddFilter(&filter{cors: c, origin: origin, hasOrigin: hasOrigin})
+			next(w, req)
+		}
+	}, nil
+}
+
+type cors struct {
+	opts Options
+}
+
+func (c *cors) preflight(w *response.Writer, req *request.Request, origin, method string) {
+	h := response.GetDefaultHeaders(0)
+	h.Remove("Content-Length")
+	h.Remove("Content-Type")
+	h.AddVary("Origin")
+	h.AddVary("Access-Control-Request-Method")
+	h.AddVary("Access-Control-Request-Headers")
+
+	// A refused preflight gets no CORS headers, which the browser reports
+	// to the script as a network error
+	requested, _ := req.Headers.Get("Access-Control-Request-Headers")
+	if c.allowOrigin(origin) && slices.Contains(c.opts.AllowedMethods, method) && c.allowHeaders(requested) {
+		c.setOrigin(h, origin)
+		h.Set("Access-Control-Allow-Methods", strings.Join(c.opts.AllowedMethods, ", "))
+		if requested != "" {
+			// Echoing the request covers * too, which browsers don't honour
+			// with credentials
+			h.Set("Access-Control-Allow-Headers", requested)
+		}
+		if c.opts.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.opts.MaxAge.Seconds())))
+		}
+	}
+
+	w.WriteStatusLine(response.StatusNoContent)
+	w.WriteHeaders(h)
+}
+
+func (c *cors) allowOrigin(origin string) bool {
+	for _, allowed := range c.opts.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if scheme, domain, ok := strings.Cut(allowed, "://*."); ok {
+			// The wildcard needs at least one label, so it doesn't match the
+			// bare domain
+			originScheme, host, ok := strings.Cut(origin, "://")
+			if ok && strings.EqualFold(scheme, originScheme) &&
+				len(host) > len(domain)+1 && strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(domain)) {
+				return true
+			}
+		}
+	}
+	return c.opts.AllowOriginFunc != nil && c.opts.AllowOriginFunc(origin)
+}
+
+// Requested header names, comma separated, must all be allowed
+func (c *cors) allowHeaders(requested string) bool {
+	if slices.Contains(c.opts.AllowedHeaders, "*") {
+		return true
+	}
+	for name := range strings.SplitSeq(requested, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.ContainsFunc(c.opts.AllowedHeaders, func(allowed string) bool {
+			return strings.EqualFold(allowed, name)
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether every origin gets the same answer, so responses don't vary on it.
+// Middleware makes sure credentials aren't allowed then.
+func (c *cors) anyOrigin() bool {
+	return slices.Contains(c.opts.AllowedOrigins, "*")
+}
+
+func (c *cors) setOrigin(h headers.Headers, origin string) {
+	if c.anyOrigin() {
+		h.Replace("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.Replace("Access-Control-Allow-Origin", origin)
+	if c.opts.AllowCredentials {
+		h.Replace("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// Adds the CORS headers to an actual, non-preflight, response
+type filter struct {
+	cors      *cors
+	origin    string
+	hasOrigin bool
+}
+
+func (f *filter) Headers(_ response.StatusCode, h headers.Headers) {
+	if !f.cors.anyOrigin() {
+		h.AddVary("Origin")
+	}
+	if !f.hasOrigin || !f.cors.allowOrigin(f.origin) {
+		return
+	}
+	f.cors.setOrigin(h, f.origin)
+	if len(f.cors.opts.ExposedHeaders) > 0 {
+		h.Replace("Access-Control-Expose-Headers", strings.Join(f.cors.opts.ExposedHeaders, ", "))
+	}
+}
+
+func (f *filter) Body(io.Writer) io.WriteCloser {
+	return nil
+}
@@ -0,0 +1,108 @@
+package cors
+
+import (
+	"httpfromtcp/internal/handlertest"
+	"httpfromtcp/internal/server"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHandler(t *testing.T, opts Options) server.Handler {
+	t.Helper()
+	mw, err := Middleware(opts)
+	require.NoError(t, err)
+	return mw(handlertest.OK)
+}
+
+func serve(t *testing.T, handler server.Handler, method, header string) (*http.Response, string) {
+	t.Helper()
+	return handlertest.Serve(t, handler, handlertest.NewRequest(t, method, "/api", header, ""))
+}
+
+func TestPreflight(t *testing.T) {
+	handler := newHandler(t, Options{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods:   []string{"GET", "PUT"},
+		AllowedHeaders:   []string{"Content-Type", "X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	preflight := func(origin, method, headers string) http.Header {
+		header := "Origin: " + origin + "\r\nAccess-Control-Request-Method: " + method + "\r\n"
+		if headers != "" {
+			header += "Access-Control-Request-Headers: " + headers + "\r\n"
+		}
+		res, body := serve(t, handler, "OPTIONS", header)
+		assert.Equal(t, 204, res.StatusCode)
+		assert.Empty(t, body)
+		return res.Header
+	}
+
+	// Test: Allowed preflight is answered without reaching the handler
+	h := preflight("https://app.example.com", "PUT", "content-type,x-request-id")
+	assert.Equal(t, "https://app.example.com", h.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", h.Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, PUT", h.Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "content-type,x-request-id", h.Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", h.Get("Access-Control-Max-Age"))
+	assert.Equal(t, "Origin, Access-Control-Request-Method, Access-Control-Request-Headers", h.Get("Vary"))
+	assert.Empty(t, h.Values("Content-Length"))
+
+	// Test: Wildcard subdomains match any depth but not the bare domain
+	assert.Equal(t, "https://a.b.example.org", preflight("https://a.b.example.org", "GET", "").Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, preflight("https://example.org", "GET", "").Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, preflight("http://a.example.org", "GET", "").Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, preflight("https://evilexample.org", "GET", "").Get("Access-Control-Allow-Origin"))
+
+	// Test: Refused origins, methods and headers get a bare 204
+	for _, h := range []http.Header{
+		preflight("https://evil.example.com", "GET", ""),
+		preflight("https://app.example.com", "DELETE", ""),
+		preflight("https://app.example.com", "GET", "X-Secret"),
+	} {
+		assert.Empty(t, h.Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, h.Get("Access-Control-Allow-Methods"))
+	}
+
+	// Test: OPTIONS without preflight headers reaches the handler
+	_, body := serve(t, handler, "OPTIONS", "Origin: https://app.example.com\r\n")
+	assert.Equal(t, "ok", body)
+}
+
+func TestActualRequests(t *testing.T) {
+	handler := newHandler(t, Options{
+		AllowOriginFunc: func(origin string) bool { return strings.HasSuffix(origin, ".internal") },
+		ExposedHeaders:  []string{"X-Request-ID", "RateLimit-Remaining"},
+	})
+
+	// Test: Allowed origin is echoed with exposed headers
+	res, body := serve(t, handler, "GET", "Origin: http://dash.internal\r\n")
+	assert.Equal(t, "ok", body)
+	assert.Equal(t, "http://dash.internal", res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Request-ID, RateLimit-Remaining", res.Header.Get("Access-Control-Expose-Headers"))
+	assert.Empty(t, res.Header.Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "Origin", res.Header.Get("Vary"))
+
+	// Test: Other origins and same-origin requests still get Vary: Origin
+	res, _ = serve(t, handler, "GET", "Origin: https://evil.example\r\n")
+	assert.Empty(t, res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", res.Header.Get("Vary"))
+	res, _ = serve(t, handler, "GET", "")
+	assert.Equal(t, "Origin", res.Header.Get("Vary"))
+
+	// Test: Any origin is answered with * and no Vary
+	handler = newHandler(t, Options{AllowedOrigins: []string{"*"}})
+	res, _ = serve(t, handler, "GET", "Origin: https://anyone.example\r\n")
+	assert.Equal(t, "*", res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, res.Header.Values("Vary"))
+
+	// Test: Any origin with credentials is refused, as every site would get
+	// the user's session
+	_, err := Middleware(Options{AllowedOrigins: []string{"https://app.example.com", "*"}, AllowCredentials: true})
+	assert.ErrorIs(t, err, ErrCredentialsWithAnyOrigin)
+}
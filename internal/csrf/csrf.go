@@ -0,0 +1,249 @@
+package csrf
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/cookie"
+	"httpfromtcp/internal/form"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Defaults for the names in Options
+const (
+	DefaultCookie = "csrf_token"
+	DefaultHeader = "X-CSRF-Token"
+	DefaultField  = "csrf_token"
+)
+
+// Bytes of randomness in a token
+const tokenSize = 32
+
+// Reasons requests are refused, sent to the client in the 403 body
+var (
+	ErrCrossOrigin = errors.New("cross-origin request")
+	ErrNoCookie    = errors.New("CSRF cookie missing")
+	ErrNoToken     = errors.New("CSRF token missing")
+	ErrBadToken    = errors.New("CSRF token invalid")
+)
+
+type Options struct {
+	// Cookie holding the token, DefaultCookie when empty
+	Cookie string
+	// Header and form field the token is taken from, DefaultHeader and
+	// DefaultField when empty. The header is checked first.
+	Header string
+	Field  string
+	// TrustedOrigins may send cross-origin requests, such as
+	// https://admin.example.com. They still need a token.
+	TrustedOrigins []string
+	// Secure makes browsers only send the cookie over HTTPS. Cookies set on
+	// requests received over TLS are always Secure.
+	Secure bool
+	// Exempt skips the checks for requests it returns true for, such as API
+	// calls authenticated with bearer tokens, which browsers don't send on
+	// their own
+	Exempt func(req *request.Request) bool
+}
+
+type contextKey struct{}
+
+// Middleware protects against cross-site request forgery with the double
+// submit cookie pattern. Each client gets a random token in a cookie, and
+// requests with unsafe methods must send it back in the header or form
+// field, which other sites can't do as they can't read the cookie. Before
+// that, requests browsers mark as cross-origin with Sec-Fetch-Site or
+// Origin are refused outright. Refused requests are answered with 403
+// Forbidden and the reason.
+//
+// Handlers put the token from Token in their forms, or in a page for
+// scripts to send in the header. Form fields are read from URL-encoded
+// bodies, or multipart ones when form.Middleware comes first, so the
+// middleware must come after any that decodes the body.
+func Middleware(opts Options) server.Middleware {
+	if opts.Cookie == "" {
+		opts.Cookie = DefaultCookie
+	}
+	if opts.Header == "" {
+		opts.Header = DefaultHeader
+	}
+	if opts.Field == "" {
+		opts.Field = DefaultField
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			token, fromCookie := cookieToken(req, opts.Cookie)
+			if !fromCookie {
+				token = make([]byte, tokenSize)
+				rand.Read(token)
+				w.AddFilter(&cookieFilter{opts: &opts, token: token, secure: opts.Secure || req.TLS != nil})
+			}
+
+			if !safeMethod(req.RequestLine.Method) && (opts.Exempt == nil || !opts.Exempt(req)) {
+				err := checkOrigin(req, opts.TrustedOrigins)
+				if err == nil && !fromCookie {
+					err = ErrNoCookie
+				}
+				if err == nil {
+					err = checkToken(req, &opts, token)
+				}
+				if err != nil {
+					writeForbidden(w, err)
+					return
+				}
+			}
+
+			next(w, req.WithValue(contextKey{}, token))
+		}
+	}
+}
+
+// Token returns the request's token for a form field or header, or "" outside
+// of Middleware. It's masked with fresh random bytes on every call, so
+// compressed responses don't leak it (BREACH).
+func Token(ctx context.Context) string {
+	token, _ := ctx.Value(contextKey{}).([]byte)
+	if token == nil {
+		return ""
+	}
+	masked := make([]byte, 2*tokenSize)
+	rand.Read(masked[:tokenSize])
+	subtle.XORBytes(masked[tokenSize:], masked[:tokenSize], token)
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+func unmask(s string) []byte {
+	masked, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(masked) != 2*tokenSize {
+		return nil
+	}
+	token := make([]byte, tokenSize)
+	subtle.XORBytes(token, masked[:tokenSize], masked[tokenSize:])
+	return token
+}
+
+func cookieToken(req *request.Request, name string) ([]byte, bool) {
+	c, ok := req.Cookie(name)
+	if !ok {
+		return nil, false
+	}
+	token, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil || len(token) != tokenSize {
+		return nil, false
+	}
+	return token, true
+}
+
+// Methods that mustn't change anything, as RFC 9110 defines them
+func safeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// Browsers send Sec-Fetch-Site with every request and Origin with most that
+// aren't GET. Requests with neither didn't come from a browser, or one too
+// old to know them, and are left to the token.
+func checkOrigin(req *request.Request, trusted []string) error {
+	origin, hasOrigin := req.Headers.Get("Origin")
+	if hasOrigin && slices.ContainsFunc(trusted, func(t string) bool { return strings.EqualFold(t, origin) }) {
+		return nil
+	}
+
+	if site, ok := req.Headers.Get("Sec-Fetch-Site"); ok {
+		// none is a request the user made, such as by typing the address
+		if site == "same-origin" || site == "none" {
+			return nil
+		}
+		return ErrCrossOrigin
+	}
+	if !hasOrigin {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	host, _ := req.Headers.Get("Host")
+	if err != nil || u.Host == "" || !strings.EqualFold(u.Host, host) {
+		return ErrCrossOrigin
+	}
+	return nil
+}
+
+func checkToken(req *request.Request, opts *Options, token []byte) error {
+	submitted, ok := req.Headers.Get(opts.Header)
+	if !ok {
+		submitted, ok = formValue(req, opts.Field)
+	}
+	if !ok || submitted == "" {
+		return ErrNoToken
+	}
+	if subtle.ConstantTimeCompare(unmask(submitted), token) != 1 {
+		return ErrBadToken
+	}
+	return nil
+}
+
+// From the form form.Middleware parsed, which may be multipart, or else a
+// URL-encoded body
+func formValue(req *request.Request, field string) (string, bool) {
+	var values url.Values
+	if f := form.FromContext(req.Context()); f != nil {
+		values = f.Values
+	} else {
+		var err error
+		if values, err = form.ParseURLEncoded(req); err != nil {
+			return "", false
+		}
+	}
+	if !values.Has(field) {
+		return "", false
+	}
+	return values.Get(field), true
+}
+
+func writeForbidden(w *response.Writer, reason error) {
+	status := response.StatusForbidden
+	body := []byte(fmt.Sprintf("%d %s: %s\n", status, response.StatusText(status), reason))
+	w.WriteStatusLine(status)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+// Sets the cookie for a new token. Scripts don't need to read it, they get
+// the token from the page, so it's HttpOnly.
+type cookieFilter struct {
+	opts   *Options
+	token  []byte
+	secure bool
+}
+
+func (f *cookieFilter) Headers(_ response.StatusCode, h headers.Headers) {
+	err := cookie.Set(h, &cookie.Cookie{
+		Name:     f.opts.Cookie,
+		Value:    base64.RawURLEncoding.EncodeToString(f.token),
+		Path:     "/",
+		Secure:   f.secure,
+		HttpOnly: true,
+		SameSite: cookie.SameSiteLax,
+	})
+	if err != nil {
+		slog.Error("setting CSRF cookie", "error", err)
+	}
+}
+
+func (f *cookieFilter) Body(io.Writer) io.WriteCloser {
+	return nil
+}
@@ -0,0 +1,118 @@
+package csrf
+
+import (
+	"bytes"
+	"httpfromtcp/internal/form"
+	"httpfromtcp/internal/handlertest"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Answers with a token for the next request
+func tokenHandler(w *response.Writer, req *request.Request) {
+	body := []byte(Token(req.Context()))
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func serve(t *testing.T, opts Options, method, header, body string) (*http.Response, string) {
+	t.Helper()
+	return serveChain(t, opts, method, header, body)
+}
+
+// Serves with the middleware after before
+func serveChain(t *testing.T, opts Options, method, header, body string, before ...server.Middleware) (*http.Response, string) {
+	t.Helper()
+	req := handlertest.NewRequest(t, method, "/admin", header, body)
+	req.Headers.Replace("Host", "example.com")
+	return handlertest.Serve(t, server.Chain(tokenHandler, append(before, Middleware(opts))...), req)
+}
+
+func TestMiddleware(t *testing.T) {
+	opts := Options{TrustedOrigins: []string{"https://admin.example.org"}}
+
+	// Test: A first visit gets a cookie and a token
+	res, token := serve(t, opts, "GET", "", "")
+	require.Equal(t, 200, res.StatusCode)
+	cookies := res.Cookies()
+	require.Len(t, cookies, 1)
+	c := cookies[0]
+	assert.Equal(t, DefaultCookie, c.Name)
+	assert.True(t, c.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, c.SameSite)
+	require.NotEmpty(t, token)
+	cookieHeader := "Cookie: " + c.Name + "=" + c.Value + "\r\n"
+
+	// Test: Returning visitors keep their cookie, but tokens differ every time
+	res, token2 := serve(t, opts, "GET", cookieHeader, "")
+	assert.Empty(t, res.Cookies())
+	assert.NotEqual(t, token, token2)
+
+	// Test: The token is accepted from the header or a form field
+	res, _ = serve(t, opts, "POST", cookieHeader+"X-CSRF-Token: "+token+"\r\n", "")
+	assert.Equal(t, 200, res.StatusCode)
+	encoded := url.Values{"csrf_token": {token2}, "name": {"x"}}.Encode()
+	res, _ = serve(t, opts, "POST", cookieHeader+"Content-Type: application/x-www-form-urlencoded\r\n", encoded)
+	assert.Equal(t, 200, res.StatusCode)
+
+	// Test: Multipart forms are read when form.Middleware parsed them
+	var multipartBody bytes.Buffer
+	mw := multipart.NewWriter(&multipartBody)
+	mw.WriteField("csrf_token", token)
+	mw.Close()
+	multipartHeader := cookieHeader + "Content-Type: " + mw.FormDataContentType() + "\r\n"
+	res, _ = serve(t, opts, "POST", multipartHeader, multipartBody.String())
+	assert.Equal(t, 403, res.StatusCode)
+	res, _ = serveChain(t, opts, "POST", multipartHeader, multipartBody.String(), form.Middleware(form.Options{}))
+	assert.Equal(t, 200, res.StatusCode)
+
+	// Test: Same-origin and trusted browsers still need the token
+	res, _ = serve(t, opts, "POST", cookieHeader+"Sec-Fetch-Site: same-origin\r\nX-CSRF-Token: "+token+"\r\n", "")
+	assert.Equal(t, 200, res.StatusCode)
+	res, _ = serve(t, opts, "POST", cookieHeader+"Origin: https://example.com\r\nX-CSRF-Token: "+token+"\r\n", "")
+	assert.Equal(t, 200, res.StatusCode)
+	res, _ = serve(t, opts, "POST", cookieHeader+"Origin: https://admin.example.org\r\nSec-Fetch-Site: cross-site\r\nX-CSRF-Token: "+token+"\r\n", "")
+	assert.Equal(t, 200, res.StatusCode)
+	res, body := serve(t, opts, "POST", cookieHeader+"Sec-Fetch-Site: same-origin\r\n", "")
+	assert.Equal(t, 403, res.StatusCode)
+	assert.Equal(t, "403 Forbidden: CSRF token missing\n", body)
+
+	// Test: Refused requests say why
+	for header, reason := range map[string]string{
+		cookieHeader + "Sec-Fetch-Site: cross-site\r\nX-CSRF-Token: " + token + "\r\n":   "cross-origin request",
+		cookieHeader + "Sec-Fetch-Site: same-site\r\nX-CSRF-Token: " + token + "\r\n":    "cross-origin request",
+		cookieHeader + "Origin: https://evil.example\r\nX-CSRF-Token: " + token + "\r\n": "cross-origin request",
+		cookieHeader + "Origin: null\r\nX-CSRF-Token: " + token + "\r\n":                 "cross-origin request",
+		"X-CSRF-Token: " + token + "\r\n":                                                "CSRF cookie missing",
+		cookieHeader + "X-CSRF-Token: " + c.Value + "\r\n":                               "CSRF token invalid",
+		cookieHeader + "X-CSRF-Token: not-a-token\r\n":                                   "CSRF token invalid",
+		cookieHeader + "Content-Type: text/plain\r\n":                                    "CSRF token missing",
+	} {
+		res, body := serve(t, opts, "DELETE", header, "csrf_token="+token)
+		assert.Equal(t, 403, res.StatusCode, header)
+		assert.Equal(t, "403 Forbidden: "+reason+"\n", body, header)
+	}
+
+	// Test: Another client's cookie doesn't match the token
+	res, _ = serve(t, opts, "GET", "", "")
+	other := res.Cookies()[0]
+	res, _ = serve(t, opts, "POST", "Cookie: "+other.Name+"="+other.Value+"\r\nX-CSRF-Token: "+token+"\r\n", "")
+	assert.Equal(t, 403, res.StatusCode)
+
+	// Test: Exempt requests skip the checks
+	opts.Exempt = func(req *request.Request) bool {
+		_, ok := req.Headers.Get("Authorization")
+		return ok
+	}
+	res, _ = serve(t, opts, "POST", "Authorization: Bearer abc\r\nSec-Fetch-Site: cross-site\r\n", "")
+	assert.Equal(t, 200, res.StatusCode)
+}
@@ -0,0 +1,290 @@
+package fileserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Number of bytes inspected when sniffing the content type of a file
+const sniffLen = 512
+
+const indexPage = "index.html"
+
+type Options struct {
+	// Prefix is stripped from the request path before looking the file up,
+	// so a file system can be mounted under a route such as "/assets"
+	Prefix string
+	// Browse renders an HTML listing for directories without an index.html
+	Browse bool
+	// AllowDotfiles serves files and directories whose names start with a dot
+	AllowDotfiles bool
+}
+
+// New returns a handler that serves the contents of fsys.
+func New(fsys fs.FS, opts Options) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		if !allowedMethod(w, req) {
+			return
+		}
+
+		// Only the path of the request target is used to find the file
+		u, err := url.ParseRequestURI(req.RequestLine.RequestTarget)
+		if err != nil {
+			writeError(w, response.StatusBadRequest)
+			return
+		}
+
+		p := u.Path
+		if opts.Prefix != "" {
+			prefix := strings.TrimSuffix(opts.Prefix, "/")
+			if p != prefix && !strings.HasPrefix(p, prefix+"/") {
+				writeError(w, response.StatusNotFound)
+				return
+			}
+			p = strings.TrimPrefix(p, prefix)
+		}
+
+		name, status := resolve(p, opts)
+		if status != response.StatusOK {
+			writeError(w, status)
+			return
+		}
+
+		f, err := fsys.Open(name)
+		if err != nil {
+			writeError(w, errorStatus(err))
+			return
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil {
+			writeError(w, errorStatus(err))
+			return
+		}
+
+		if !fi.IsDir() {
+			serveContent(w, req, name, f, fi)
+			return
+		}
+
+		// Directories are always addressed with a trailing slash so relative
+		// links in index pages and listings resolve inside the directory. The
+		// Location is relative to the last segment, since echoing the path
+		// would turn a request for //evil.example/dir into a redirect to
+		// another host.
+		if !strings.HasSuffix(u.Path, "/") {
+			location := &url.URL{Path: path.Base(u.Path) + "/", RawQuery: u.RawQuery}
+			redirect(w, location.String())
+			return
+		}
+
+		index, err := fsys.Open(path.Join(name, indexPage))
+		if err == nil {
+			defer index.Close()
+			ifi, err := index.Stat()
+			if err == nil && !ifi.IsDir() {
+				serveContent(w, req, indexPage, index, ifi)
+				return
+			}
+		}
+
+		if !opts.Browse {
+			writeError(w, response.StatusForbidden)
+			return
+		}
+
+		entries, err := fs.ReadDir(fsys, name)
+		if err != nil {
+			writeError(w, errorStatus(err))
+			return
+		}
+		serveListing(w, req, u.Path, entries, opts)
+	}
+}
+
+// ServeFile responds with the contents of the named file in fsys regardless
+// of the request target. The name is trusted and must be a valid fs.FS path.
+func ServeFile(w *response.Writer, req *request.Request, fsys fs.FS, name string) {
+	if !allowedMethod(w, req) {
+		return
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		writeError(w, errorStatus(err))
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		writeError(w, errorStatus(err))
+		return
+	}
+	if fi.IsDir() {
+		writeError(w, response.StatusNotFound)
+		return
+	}
+
+	serveContent(w, req, name, f, fi)
+}
+
+// Resolve the URL path relative to the file server root into an fs.FS name.
+// Paths that try to escape the root are forbidden and dotfiles are reported
+// as missing unless they are explicitly allowed.
+func resolve(p string, opts Options) (string, response.StatusCode) {
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." || strings.ContainsAny(segment, "\\\x00") {
+			return "", response.StatusForbidden
+		}
+		if strings.HasPrefix(segment, ".") && segment != "." && !opts.AllowDotfiles {
+			return "", response.StatusNotFound
+		}
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		return "", response.StatusForbidden
+	}
+
+	return name, response.StatusOK
+}
+
+func serveContent(w *response.Writer, req *request.Request, name string, f fs.File, fi fs.FileInfo) {
+	// Validators derived from the file's metadata change whenever it's replaced
+	etag := fmt.Sprintf("\"%x-%x\"", fi.ModTime().UnixNano(), fi.Size())
+
+	// Seekable files support range requests
+	if content, ok := f.(io.ReadSeeker); ok {
+		h := headers.NewHeaders()
+		h.Set("ETag", etag)
+		response.ServeContent(w, req, name, fi.ModTime(), content, h)
+		return
+	}
+
+	if response.CheckPreconditions(w, req, etag, fi.ModTime()) {
+		return
+	}
+
+	var body io.Reader = f
+
+	// Prefer the extension and fall back to sniffing the start of the file
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		buf := make([]byte, sniffLen)
+		n, err := io.ReadFull(f, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			writeError(w, response.StatusInternalServerError)
+			return
+		}
+		contentType = http.DetectContentType(buf[:n])
+		body = io.MultiReader(bytes.NewReader(buf[:n]), f)
+	}
+
+	headers := response.GetDefaultHeaders(0)
+	headers.Replace("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	headers.Replace("Content-Type", contentType)
+	headers.Replace("ETag", etag)
+	headers.Replace("Last-Modified", fi.ModTime().UTC().Format(response.TimeFormat))
+
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(headers)
+	if req.RequestLine.Method == "HEAD" {
+		return
+	}
+	io.Copy(w, body)
+}
+
+func serveListing(w *response.Writer, req *request.Request, dir string, entries []fs.DirEntry, opts Options) {
+	title := html.EscapeString("Index of " + dir)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<html>\n<head>\n<title>%s</title>\n</head>\n<body>\n<h1>%s</h1>\n<ul>\n", title, title)
+	if dir != "/" {
+		b.WriteString("<li><a href=\"../\">../</a></li>\n")
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") && !opts.AllowDotfiles {
+			continue
+		}
+		if entry.IsDir() {
+			name += "/"
+		}
+		// Prefix with ./ so names containing a colon aren't read as a scheme
+		href := "./" + (&url.URL{Path: name}).EscapedPath()
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(href), html.EscapeString(name))
+	}
+	b.WriteString("</ul>\n</body>\n</html>")
+
+	body := []byte(b.String())
+	headers := response.GetDefaultHeaders(len(body))
+	headers.Replace("Content-Type", "text/html; charset=utf-8")
+
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(headers)
+	if req.RequestLine.Method == "HEAD" {
+		return
+	}
+	w.WriteBody(body)
+}
+
+func allowedMethod(w *response.Writer, req *request.Request) bool {
+	if req.RequestLine.Method == "GET" || req.RequestLine.Method == "HEAD" {
+		return true
+	}
+
+	body := []byte(fmt.Sprintf("%d %s\n", response.StatusMethodNotAllowed, response.StatusText(response.StatusMethodNotAllowed)))
+	headers := response.GetDefaultHeaders(len(body))
+	headers.Set("Allow", "GET, HEAD")
+
+	w.WriteStatusLine(response.StatusMethodNotAllowed)
+	w.WriteHeaders(headers)
+	w.WriteBody(body)
+	return false
+}
+
+func redirect(w *response.Writer, location string) {
+	headers := response.GetDefaultHeaders(0)
+	headers.Set("Location", location)
+
+	w.WriteStatusLine(response.StatusMovedPermanently)
+	w.WriteHeaders(headers)
+}
+
+func writeError(w *response.Writer, status response.StatusCode) {
+	body := []byte(fmt.Sprintf("%d %s\n", status, response.StatusText(status)))
+
+	w.WriteStatusLine(status)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func errorStatus(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return response.StatusNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return response.StatusForbidden
+	default:
+		return response.StatusInternalServerError
+	}
+}
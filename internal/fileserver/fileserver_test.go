@@ -0,0 +1,162 @@
+package fileserver
+
+import (
+	"httpfromtcp/internal/handlertest"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"net/http"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFS = fstest.MapFS{
+	"hello.txt":           {Data: []byte("hello world!\n"), ModTime: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)},
+	"noext":               {Data: []byte("<!DOCTYPE html><html></html>")},
+	"docs/index.html":     {Data: []byte("<h1>docs</h1>")},
+	"build/app.js":        {Data: []byte("console.log(1)")},
+	"build/a b.txt":       {Data: []byte("spaces")},
+	"build/.hidden":       {Data: []byte("hidden")},
+	".env":                {Data: []byte("SECRET=1")},
+	".well-known/foo.txt": {Data: []byte("foo")},
+}
+
+func TestFileServer(t *testing.T) {
+	h := New(testFS, Options{})
+
+	// Test: File is served with content type from its extension
+	res, body := serve(t, h, "GET", "/hello.txt")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "text/plain; charset=utf-8", res.Header.Get("Content-Type"))
+	assert.Equal(t, "13", res.Header.Get("Content-Length"))
+	assert.Equal(t, "hello world!\n", body)
+
+	// Test: Content type is sniffed when the file has no extension
+	res, body = serve(t, h, "GET", "/noext")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", res.Header.Get("Content-Type"))
+	assert.Equal(t, "<!DOCTYPE html><html></html>", body)
+
+	// Test: HEAD sends headers without a body
+	res, body = serve(t, h, "HEAD", "/hello.txt")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "13", res.Header.Get("Content-Length"))
+	assert.Equal(t, "", body)
+
+	// Test: Directory with an index page
+	res, body = serve(t, h, "GET", "/docs/")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "<h1>docs</h1>", body)
+
+	// Test: Directory without a trailing slash is redirected
+	res, _ = serve(t, h, "GET", "/docs?x=1")
+	assert.Equal(t, 301, res.StatusCode)
+	assert.Equal(t, "docs/?x=1", res.Header.Get("Location"))
+
+	// Test: Redirect stays on this host when the path starts with //
+	res, _ = serve(t, h, "GET", "//docs")
+	assert.Equal(t, 301, res.StatusCode)
+	assert.Equal(t, "docs/", res.Header.Get("Location"))
+
+	// Test: Directory without an index page and browsing disabled
+	res, _ = serve(t, h, "GET", "/build/")
+	assert.Equal(t, 403, res.StatusCode)
+
+	// Test: Missing file
+	res, _ = serve(t, h, "GET", "/missing.txt")
+	assert.Equal(t, 404, res.StatusCode)
+
+	// Test: Path traversal is refused, including when percent-encoded
+	res, _ = serve(t, h, "GET", "/../hello.txt")
+	assert.Equal(t, 403, res.StatusCode)
+	res, _ = serve(t, h, "GET", "/docs/%2e%2e/hello.txt")
+	assert.Equal(t, 403, res.StatusCode)
+
+	// Test: Dotfiles are hidden by default
+	res, _ = serve(t, h, "GET", "/.env")
+	assert.Equal(t, 404, res.StatusCode)
+	res, _ = serve(t, h, "GET", "/.well-known/foo.txt")
+	assert.Equal(t, 404, res.StatusCode)
+
+	// Test: Unsupported method
+	res, _ = serve(t, h, "POST", "/hello.txt")
+	assert.Equal(t, 405, res.StatusCode)
+	assert.Equal(t, "GET, HEAD", res.Header.Get("Allow"))
+}
+
+func TestFileServerOptions(t *testing.T) {
+	// Test: Directory listing with prefix
+	h := New(testFS, Options{Prefix: "/static", Browse: true})
+	res, body := serve(t, h, "GET", "/static/build/")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", res.Header.Get("Content-Type"))
+	assert.Contains(t, body, `<a href="./app.js">app.js</a>`)
+	assert.Contains(t, body, `<a href="./a%20b.txt">a b.txt</a>`)
+	assert.Contains(t, body, `<a href="../">../</a>`)
+	assert.NotContains(t, body, ".hidden")
+
+	// Test: Paths outside the prefix are not found
+	res, _ = serve(t, h, "GET", "/hello.txt")
+	assert.Equal(t, 404, res.StatusCode)
+
+	// Test: Prefix root is redirected to the directory
+	res, _ = serve(t, h, "GET", "/static")
+	assert.Equal(t, 301, res.StatusCode)
+	assert.Equal(t, "static/", res.Header.Get("Location"))
+
+	// Test: Dotfiles are served when allowed
+	h = New(testFS, Options{AllowDotfiles: true})
+	res, body = serve(t, h, "GET", "/.well-known/foo.txt")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "foo", body)
+}
+
+func TestFileServerConditional(t *testing.T) {
+	h := New(testFS, Options{})
+
+	// Test: Responses carry validators
+	res, _ := serve(t, h, "GET", "/hello.txt")
+	etag := res.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+	lastModified := res.Header.Get("Last-Modified")
+	require.NotEmpty(t, lastModified)
+
+	// Test: Revalidating with either validator is answered with 304
+	res, body := serve(t, h, "GET", "/hello.txt", "If-None-Match: "+etag)
+	assert.Equal(t, 304, res.StatusCode)
+	assert.Equal(t, "", body)
+	res, _ = serve(t, h, "GET", "/hello.txt", "If-Modified-Since: "+lastModified)
+	assert.Equal(t, 304, res.StatusCode)
+
+	// Test: Range with a matching If-Range
+	res, body = serve(t, h, "GET", "/hello.txt", "Range: bytes=0-4", "If-Range: "+etag)
+	assert.Equal(t, 206, res.StatusCode)
+	assert.Equal(t, "hello", body)
+}
+
+func TestServeFile(t *testing.T) {
+	h := func(w *response.Writer, req *request.Request) {
+		ServeFile(w, req, testFS, "build/app.js")
+	}
+
+	// Test: Named file is served regardless of the request target
+	res, body := serve(t, h, "GET", "/anything")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "console.log(1)", body)
+	assert.Contains(t, res.Header.Get("Content-Type"), "javascript")
+}
+
+// Run the handler on a request with the given header lines
+func serve(t *testing.T, h server.Handler, method, target string, reqHeaders ...string) (*http.Response, string) {
+	t.Helper()
+
+	header := ""
+	for _, line := range reqHeaders {
+		header += line + "\r\n"
+	}
+	return handlertest.Serve(t, h, handlertest.NewRequest(t, method, target, header, ""))
+}
@@ -0,0 +1,176 @@
+package form
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"mime"
+	"net/url"
+)
+
+// Limits used unless Options gives others
+const (
+	DefaultMaxPartSize = 16 << 20
+	// The most a server reads by default
+	DefaultMaxSize  = server.DefaultMaxBodySize
+	DefaultMaxParts = 1000
+)
+
+var (
+	// ErrNotForm means the request body isn't URL-encoded or multipart
+	ErrNotForm      = errors.New("request body is not a form")
+	ErrTooLarge     = errors.New("form too large")
+	ErrPartTooLarge = errors.New("form part too large")
+	ErrTooManyParts = errors.New("too many form parts")
+)
+
+// Options limit what a form may hold. Parsed forms are kept in memory, on
+// top of the request body the server already read.
+type Options struct {
+	// MaxPartSize limits each value or file, DefaultMaxPartSize when zero
+	MaxPartSize int64
+	// MaxSize limits all values and files together, DefaultMaxSize when zero
+	MaxSize int64
+	// MaxParts limits the number of multipart parts, DefaultMaxParts when
+	// zero
+	MaxParts int
+}
+
+// A copy of the options with the defaults filled in
+func (o Options) withDefaults() Options {
+	if o.MaxPartSize == 0 {
+		o.MaxPartSize = DefaultMaxPartSize
+	}
+	if o.MaxSize == 0 {
+		o.MaxSize = DefaultMaxSize
+	}
+	if o.MaxParts == 0 {
+		o.MaxParts = DefaultMaxParts
+	}
+	return o
+}
+
+// Form is a parsed form body.
+type Form struct {
+	Values url.Values
+	// Files uploaded in multipart forms, by field name
+	Files map[string][]*File
+}
+
+// Value returns the first value of the field, or "" if there is none.
+func (f *Form) Value(name string) string {
+	return f.Values.Get(name)
+}
+
+// File returns the first file uploaded in the field, ok false if there is
+// none.
+func (f *Form) File(name string) (*File, bool) {
+	files := f.Files[name]
+	if len(files) == 0 {
+		return nil, false
+	}
+	return files[0], true
+}
+
+// File is a file uploaded in a multipart form.
+type File struct {
+	// FileName is the name the client gave, without any directories. It
+	// can't be trusted otherwise, so don't use it as a path.
+	FileName string
+	Header   headers.Headers
+	Size     int64
+
+	content []byte
+}
+
+// Open returns the file's contents.
+func (f *File) Open() (io.ReadSeekCloser, error) {
+	return nopCloser{bytes.NewReader(f.content)}, nil
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// ParseURLEncoded parses an application/x-www-form-urlencoded body.
+func ParseURLEncoded(req *request.Request) (url.Values, error) {
+	if mediaType(req) != "application/x-www-form-urlencoded" {
+		return nil, ErrNotForm
+	}
+	return url.ParseQuery(string(req.Body))
+}
+
+// Parse parses a URL-encoded or multipart form body.
+func Parse(req *request.Request, opts Options) (*Form, error) {
+	switch mediaType(req) {
+	case "application/x-www-form-urlencoded":
+		if int64(len(req.Body)) > opts.withDefaults().MaxSize {
+			return nil, ErrTooLarge
+		}
+		values, err := ParseURLEncoded(req)
+		if err != nil {
+			return nil, err
+		}
+		return &Form{Values: values, Files: map[string][]*File{}}, nil
+	case "multipart/form-data":
+		return ParseMultipart(req, opts)
+	}
+	return nil, ErrNotForm
+}
+
+func mediaType(req *request.Request) string {
+	contentType, _ := req.Headers.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType
+}
+
+type contextKey struct{}
+
+// Middleware parses form bodies before the handler runs, so it can get the
+// form from FromContext.
+// Forms over the limits are answered with 413 Payload Too Large, malformed
+// ones with 400 Bad Request. Requests without a form body pass through.
+func Middleware(opts Options) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			f, err := Parse(req, opts)
+			if errors.Is(err, ErrNotForm) {
+				next(w, req)
+				return
+			}
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			next(w, req.WithValue(contextKey{}, f))
+		}
+	}
+}
+
+// FromContext returns the form Middleware parsed, or nil if the request
+// didn't have one.
+func FromContext(ctx context.Context) *Form {
+	f, _ := ctx.Value(contextKey{}).(*Form)
+	return f
+}
+
+func writeError(w *response.Writer, err error) {
+	status := response.StatusBadRequest
+	if errors.Is(err, ErrTooLarge) || errors.Is(err, ErrPartTooLarge) || errors.Is(err, ErrTooManyParts) {
+		status = response.StatusPayloadTooLarge
+	}
+	body := []byte(fmt.Sprintf("%d %s: %s\n", status, response.StatusText(status), err))
+	w.WriteStatusLine(status)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
@@ -0,0 +1,79 @@
+package form
+
+import (
+	"bytes"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func formRequest(t *testing.T, contentType, body string) *request.Request {
+	t.Helper()
+	raw := "POST /form HTTP/1.1\r\nHost: localhost\r\nContent-Type: " + contentType + "\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	return req
+}
+
+func TestParse(t *testing.T) {
+	// Test: URL-encoded bodies, with parameters on the content type
+	req := formRequest(t, "application/x-www-form-urlencoded; charset=utf-8", "name=J%C3%BCrgen&tag=a&tag=b+c&empty=")
+	f, err := Parse(req, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "Jürgen", f.Value("name"))
+	assert.Equal(t, []string{"a", "b c"}, f.Values["tag"])
+	assert.True(t, f.Values.Has("empty"))
+	assert.Empty(t, f.Files)
+
+	values, err := ParseURLEncoded(req)
+	require.NoError(t, err)
+	assert.Equal(t, f.Values, values)
+
+	// Test: Malformed, oversized and non-form bodies
+	_, err = Parse(formRequest(t, "application/x-www-form-urlencoded", "a=%zz"), Options{})
+	assert.Error(t, err)
+	_, err = Parse(formRequest(t, "application/x-www-form-urlencoded", "a=12345"), Options{MaxSize: 4})
+	assert.ErrorIs(t, err, ErrTooLarge)
+	_, err = Parse(formRequest(t, "application/json", "{}"), Options{})
+	assert.ErrorIs(t, err, ErrNotForm)
+}
+
+func TestMiddleware(t *testing.T) {
+	var form *Form
+	handler := Middleware(Options{MaxPartSize: 50})(func(w *response.Writer, req *request.Request) {
+		form = FromContext(req.Context())
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	})
+	serve := func(req *request.Request) string {
+		var out bytes.Buffer
+		handler(response.NewWriter(&out), req)
+		return out.String()
+	}
+
+	// Test: The handler gets the form
+	out := serve(multipartRequest(t, [][2]string{{"title", "hello"}}, [][3]string{{"upload", "a.txt", "some contents"}}))
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	require.NotNil(t, form)
+	assert.Equal(t, "hello", form.Value("title"))
+	_, ok := form.File("upload")
+	assert.True(t, ok)
+
+	// Test: Requests without a form pass through
+	out = serve(formRequest(t, "text/plain", "hi"))
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.Nil(t, form)
+
+	// Test: Oversized and malformed forms are refused
+	out = serve(multipartRequest(t, [][2]string{{"title", strings.Repeat("x", 51)}}, nil))
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 413 Payload Too Large\r\n"))
+	assert.True(t, strings.HasSuffix(out, "413 Payload Too Large: form part too large\n"))
+	out = serve(formRequest(t, "multipart/form-data; boundary=x", "not multipart"))
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 400 Bad Request\r\n"))
+}
@@ -0,0 +1,130 @@
+package form
+
+import (
+	"bytes"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+)
+
+// Reader reads a multipart/form-data body one part at a time. It doesn't
+// stream from the connection: the server reads the whole body, up to its
+// MaxBodySize, before the handler runs, so a Reader only saves the copy of
+// each part that ParseMultipart makes.
+type Reader struct {
+	mr    *multipart.Reader
+	opts  Options
+	parts int
+	// Bytes read from all parts so far
+	size int64
+}
+
+// NewReader returns a Reader for the request's multipart/form-data body.
+func NewReader(req *request.Request, opts Options) (*Reader, error) {
+	contentType, _ := req.Headers.Get("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return nil, ErrNotForm
+	}
+	return &Reader{
+		mr:   multipart.NewReader(bytes.NewReader(req.Body), params["boundary"]),
+		opts: opts.withDefaults(),
+	}, nil
+}
+
+// NextPart returns the next part, skipping whatever is left of the previous
+// one. It returns io.EOF after the last part.
+func (r *Reader) NextPart() (*Part, error) {
+	p, err := r.mr.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	r.parts++
+	if r.parts > r.opts.MaxParts {
+		return nil, ErrTooManyParts
+	}
+
+	h := headers.NewHeaders()
+	for key, values := range p.Header {
+		for _, value := range values {
+			h.Set(key, value)
+		}
+	}
+	return &Part{Name: p.FormName(), FileName: p.FileName(), Header: h, part: p, r: r}, nil
+}
+
+// Part is a value or file in a multipart form. Reading it fails with
+// ErrPartTooLarge or ErrTooLarge once it passes the limits.
+type Part struct {
+	// Name of the form field, from Content-Disposition
+	Name string
+	// FileName is set for file uploads, without any directories
+	FileName string
+	Header   headers.Headers
+
+	part *multipart.Part
+	r    *Reader
+	size int64
+}
+
+func (p *Part) Read(b []byte) (int, error) {
+	n, err := p.part.Read(b)
+	p.size += int64(n)
+	p.r.size += int64(n)
+	if p.size > p.r.opts.MaxPartSize {
+		return n, ErrPartTooLarge
+	}
+	if p.r.size > p.r.opts.MaxSize {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
+
+// ParseMultipart reads a whole multipart/form-data body, copying each value
+// and file into memory.
+func ParseMultipart(req *request.Request, opts Options) (*Form, error) {
+	r, err := NewReader(req, opts)
+	if err != nil {
+		return nil, err
+	}
+	f := &Form{Values: url.Values{}, Files: map[string][]*File{}}
+	if err := r.readForm(f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (r *Reader) readForm(f *Form) error {
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Parts without a name can't be looked up, and browsers don't send
+		// them
+		if p.Name == "" {
+			continue
+		}
+
+		var content bytes.Buffer
+		if _, err := io.Copy(&content, p); err != nil {
+			return err
+		}
+		if p.FileName == "" {
+			f.Values.Add(p.Name, content.String())
+			continue
+		}
+		f.Files[p.Name] = append(f.Files[p.Name], &File{
+			FileName: p.FileName,
+			Header:   p.Header,
+			Size:     int64(content.Len()),
+			content:  content.Bytes(),
+		})
+	}
+}
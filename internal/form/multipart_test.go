@@ -0,0 +1,130 @@
+package form
+
+import (
+	"bytes"
+	"httpfromtcp/internal/request"
+	"io"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A request with a multipart body holding the fields, then the files
+func multipartRequest(t *testing.T, fields [][2]string, files [][3]string) *request.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, field := range fields {
+		require.NoError(t, mw.WriteField(field[0], field[1]))
+	}
+	for _, file := range files {
+		fw, err := mw.CreateFormFile(file[0], file[1])
+		require.NoError(t, err)
+		fw.Write([]byte(file[2]))
+	}
+	require.NoError(t, mw.Close())
+
+	raw := "POST /upload HTTP/1.1\r\nHost: localhost\r\n" +
+		"Content-Type: " + mw.FormDataContentType() + "\r\n" +
+		"Content-Length: " + strconv.Itoa(body.Len()) + "\r\n\r\n" + body.String()
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	return req
+}
+
+func TestReader(t *testing.T) {
+	req := multipartRequest(t, [][2]string{{"title", "hello"}}, [][3]string{{"upload", "../../notes.txt", "file contents"}})
+
+	// Test: Parts come in order with their headers
+	r, err := NewReader(req, Options{})
+	require.NoError(t, err)
+	p, err := r.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "title", p.Name)
+	assert.Empty(t, p.FileName)
+	value, err := io.ReadAll(p)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(value))
+
+	p, err = r.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "upload", p.Name)
+	assert.Equal(t, "notes.txt", p.FileName)
+	contentType, _ := p.Header.Get("Content-Type")
+	assert.Equal(t, "application/octet-stream", contentType)
+	content, err := io.ReadAll(p)
+	require.NoError(t, err)
+	assert.Equal(t, "file contents", string(content))
+
+	_, err = r.NextPart()
+	assert.Equal(t, io.EOF, err)
+
+	// Test: Reading fails once a part or the whole form passes its limit
+	r, err = NewReader(req, Options{MaxPartSize: 10})
+	require.NoError(t, err)
+	_, err = r.NextPart()
+	require.NoError(t, err)
+	p, err = r.NextPart()
+	require.NoError(t, err)
+	_, err = io.ReadAll(p)
+	assert.ErrorIs(t, err, ErrPartTooLarge)
+
+	r, err = NewReader(req, Options{MaxSize: 10})
+	require.NoError(t, err)
+	p, _ = r.NextPart()
+	io.ReadAll(p)
+	p, _ = r.NextPart()
+	_, err = io.ReadAll(p)
+	assert.ErrorIs(t, err, ErrTooLarge)
+
+	// Test: Too many parts
+	r, err = NewReader(req, Options{MaxParts: 1})
+	require.NoError(t, err)
+	_, err = r.NextPart()
+	require.NoError(t, err)
+	_, err = r.NextPart()
+	assert.ErrorIs(t, err, ErrTooManyParts)
+
+	// Test: Other bodies aren't multipart forms
+	req.Headers.Replace("Content-Type", "multipart/form-data")
+	_, err = NewReader(req, Options{})
+	assert.ErrorIs(t, err, ErrNotForm)
+}
+
+func TestParseMultipart(t *testing.T) {
+	req := multipartRequest(t,
+		[][2]string{{"tag", "a"}, {"tag", "b"}},
+		[][3]string{{"small", "small.txt", "tiny"}, {"big", "big.bin", strings.Repeat("x", 100)}, {"big", "second.bin", "after"}},
+	)
+
+	// Test: Values and files, with repeated fields in order
+	f, err := ParseMultipart(req, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, f.Values["tag"])
+	assert.Equal(t, "a", f.Value("tag"))
+
+	small, ok := f.File("small")
+	require.True(t, ok)
+	assert.Equal(t, int64(4), small.Size)
+	big := f.Files["big"]
+	require.Len(t, big, 2)
+	assert.Equal(t, int64(100), big[0].Size)
+
+	for file, want := range map[*File]string{small: "tiny", big[0]: strings.Repeat("x", 100), big[1]: "after"} {
+		rc, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		assert.Equal(t, want, string(content))
+	}
+
+	// Test: A file over the part limit fails the form
+	req = multipartRequest(t, nil, [][3]string{{"big", "big.bin", strings.Repeat("x", 100)}, {"huge", "huge.bin", strings.Repeat("y", 200)}})
+	_, err = ParseMultipart(req, Options{MaxPartSize: 150})
+	assert.ErrorIs(t, err, ErrPartTooLarge)
+}
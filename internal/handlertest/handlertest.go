@@ -0,0 +1,57 @@
+package handlertest
+
+import (
+	"bufio"
+	"bytes"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// NewRequest parses a request for target on localhost. header holds extra
+// header lines, each ending in \r\n, and a Content-Length is added for a
+// non-empty body.
+func NewRequest(t testing.TB, method, target, header, body string) *request.Request {
+	t.Helper()
+
+	raw := method + " " + target + " HTTP/1.1\r\nHost: localhost\r\n" + header
+	if body != "" {
+		raw += "Content-Length: " + strconv.Itoa(len(body)) + "\r\n"
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n" + body))
+	require.NoError(t, err)
+	return req
+}
+
+// Serve runs the handler on the request and parses the response it wrote,
+// returning it with its whole body.
+func Serve(t testing.TB, h server.Handler, req *request.Request) (*http.Response, string) {
+	t.Helper()
+
+	var out bytes.Buffer
+	w := response.NewWriter(&out)
+	h(w, req)
+	require.NoError(t, w.Finish())
+
+	// The method tells ReadResponse whether a HEAD response has a body
+	res, err := http.ReadResponse(bufio.NewReader(&out), &http.Request{Method: req.RequestLine.Method})
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, string(body)
+}
+
+// OK answers 200 OK with the body "ok".
+func OK(w *response.Writer, _ *request.Request) {
+	body := []byte("ok")
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
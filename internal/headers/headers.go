@@ -16,60 +16,116 @@ func NewHeaders() Headers {
 func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 	rn := []byte("\r\n")
 
-	// Find the index of the first CRLF
-	idx := bytes.Index(data, rn)
-
-	// If not found we need more data
-	if idx == -1 {
-		return 0, false, nil
-	}
-
-	// If we find a CRLF at the start, we're done with headers
-	// Return the consumed CRLF bytes
-	if idx == 0 {
-		return len(rn), true, nil
+	for {
+		// Find the index of the next CRLF
+		idx := bytes.Index(data[n:], rn)
+
+		// If not found we need more data
+		if idx == -1 {
+			return n, false, nil
+		}
+
+		// If we find a CRLF at the start, we're done with headers. The
+		// terminating CRLF is left for the caller to consume
+		if idx == 0 {
+			return n, true, nil
+		}
+
+		// Parse the header line
+		line := string(data[n : n+idx])
+		key, value, err := parseHeaderLine(line)
+		if err != nil {
+			return 0, false, err
+		}
+
+		// Check if the header key exists and if it does add the value to a
+		// list otherwise add the key and value
+		v, exists := h[key]
+		if exists {
+			h[key] = join(key, v, value)
+		} else {
+			h[key] = value
+		}
+
+		// Count the header line plus the CRLF as consumed
+		n += idx + len(rn)
 	}
-
-	// Parse the header line
-	line := string(data[:idx])
-	key, value, err := parseHeaderLine(line)
-	if err != nil {
-		return 0, false, err
-	}
-
-	// Check if the header key exists and if it does add the value to a
-	// comma-delimited list otherwise add the key and value
-	v, exists := h[key]
-	if exists {
-		h[key] = v + ", " + value
-	} else {
-		h[key] = value
-	}
-
-	// Return the number of bytes consumed plus the CRLF
-	return idx + len(rn), false, nil
 }
 
 func (h Headers) Get(key string) (string, bool) {
-	v, ok := h[key]
+	v, ok := h[h.lookup(key)]
 	return v, ok
 }
 
 func (h Headers) Set(key, value string) {
+	key = h.lookup(key)
 	v, exists := h[key]
 	if exists {
-		h[key] = v + ", " + value
+		h[key] = join(key, v, value)
 	} else {
 		h[key] = value
 	}
 }
 
+// Values returns each value of a field that can't be combined into a comma
+// separated list, such as Set-Cookie.
+func (h Headers) Values(key string) []string {
+	v, ok := h.Get(key)
+	if !ok {
+		return nil
+	}
+	return strings.Split(v, "\n")
+}
+
+// Adds a value to a field's existing value. Most fields are comma separated
+// lists, but Cookie uses semicolons and Set-Cookie values can't be combined
+// at all. They're kept on separate lines, which no field value can contain,
+// and written as separate fields.
+func join(key, existing, value string) string {
+	switch {
+	case strings.EqualFold(key, "Set-Cookie"):
+		return existing + "\n" + value
+	case strings.EqualFold(key, "Cookie"):
+		return existing + "; " + value
+	}
+	return existing + ", " + value
+}
+
 func (h Headers) Replace(key, value string) {
+	delete(h, h.lookup(key))
 	h[key] = value
 }
 
 func (h Headers) Remove(key string) {
-	delete(h, key)
+	delete(h, h.lookup(key))
+}
+
+// AddVary adds name to the Vary header unless it's already listed, or Vary
+// is * so the response varies on everything anyway.
+func (h Headers) AddVary(name string) {
+	vary, _ := h.Get("Vary")
+	for v := range strings.SplitSeq(vary, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.EqualFold(v, name) {
+			return
+		}
+	}
+	h.Set("Vary", name)
+}
+
+// Header names are case-insensitive. Parsed request headers are stored in
+// lowercase while handlers build response headers in canonical form, so look
+// up the key as stored before falling back to the given name.
+func (h Headers) lookup(key string) string {
+	if _, ok := h[key]; ok {
+		return key
+	}
+	for k := range h {
+		if strings.EqualFold(k, key) {
+			return k
+		}
+	}
+	return key
 }
 
 func parseHeaderLine(line string) (string, string, error) {
@@ -64,3 +64,38 @@ func TestHeadersParse(t *testing.T) {
 	assert.Equal(t, "localhost:12345", headers["host"])
 	assert.Equal(t, "first-test-agent, second-test-agent", headers["user-agent"])
 }
+
+func TestAddVary(t *testing.T) {
+	// Test: Names are added once, whatever their case
+	headers := NewHeaders()
+	headers.AddVary("Accept-Encoding")
+	headers.AddVary("Origin")
+	headers.AddVary("origin")
+	assert.Equal(t, "Accept-Encoding, Origin", headers["Vary"])
+
+	// Test: Nothing is added to Vary: *
+	headers = Headers{"vary": "*"}
+	headers.AddVary("Origin")
+	assert.Equal(t, "*", headers["vary"])
+}
+
+func TestHeadersJoin(t *testing.T) {
+	// Test: Set-Cookie values are kept apart, Cookie uses semicolons
+	headers := NewHeaders()
+	data := []byte("Set-Cookie: a=1\r\nSet-Cookie: b=2; Path=/\r\nCookie: c=3\r\nCookie: d=4\r\n\r\n")
+	_, done, err := headers.Parse(data)
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, []string{"a=1", "b=2; Path=/"}, headers.Values("Set-Cookie"))
+	assert.Equal(t, "c=3; d=4", headers["cookie"])
+
+	// Test: Set does the same, and other fields stay comma separated
+	headers = NewHeaders()
+	headers.Set("Set-Cookie", "a=1")
+	headers.Set("set-cookie", "b=2")
+	headers.Set("Accept", "text/html")
+	headers.Set("Accept", "*/*")
+	assert.Equal(t, []string{"a=1", "b=2"}, headers.Values("Set-Cookie"))
+	assert.Equal(t, []string{"text/html, */*"}, headers.Values("Accept"))
+	assert.Nil(t, headers.Values("Missing"))
+}
@@ -0,0 +1,267 @@
+package jwt
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// How often JWKSFile checks whether the file changed
+const jwksCheckInterval = time.Second
+
+// ParseJWKS reads a JSON Web Key Set as in RFC 7517. Keys for encryption
+// and of unsupported types are skipped, as are malformed keys, which are
+// logged to slog.Default() so one bad entry doesn't take down the rest of
+// the set. It fails when keys were given but none is usable, while an empty
+// keys array is an empty set that verifies nothing.
+func ParseJWKS(data []byte) ([]Key, error) {
+	return parseJWKS(data, slog.Default())
+}
+
+func parseJWKS(data []byte, logger *slog.Logger) ([]Key, error) {
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing JWKS: %w", err)
+	}
+	if set.Keys == nil {
+		return nil, errors.New("JWKS has no keys member")
+	}
+
+	var keys []Key
+	var lastErr error
+	for i, raw := range set.Keys {
+		key, err := parseJWK(raw)
+		if err != nil {
+			lastErr = fmt.Errorf("JWKS key %d: %w", i, err)
+			logger.Warn("skipping JWKS key", "index", i, "error", err)
+			continue
+		}
+		if key.Algorithm != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 && len(set.Keys) > 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, errors.New("JWKS has no usable keys")
+	}
+	return keys, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	// Members holding key material, base64url without padding
+	K string `json:"k"`
+	N string `json:"n"`
+	E string `json:"e"`
+	X string `json:"x"`
+	Y string `json:"y"`
+}
+
+// Returns a Key with no algorithm for keys that should be skipped
+func parseJWK(raw []byte) (Key, error) {
+	var j jwk
+	if err := json.Unmarshal(raw, &j); err != nil {
+		return Key{}, err
+	}
+	if j.Use == "enc" {
+		return Key{}, nil
+	}
+
+	key := Key{ID: j.Kid}
+	var err error
+	switch j.Kty {
+	case "oct":
+		key.Algorithm = HS256
+		key.Key, err = decode(j.K)
+	case "RSA":
+		key.Algorithm = RS256
+		key.Key, err = rsaKey(j.N, j.E)
+	case "EC":
+		if j.Crv != "P-256" {
+			return Key{}, nil
+		}
+		key.Algorithm = ES256
+		key.Key, err = ecKey(j.X, j.Y)
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return Key{}, nil
+		}
+		key.Algorithm = EdDSA
+		var x []byte
+		x, err = decode(j.X)
+		if err == nil && len(x) != ed25519.PublicKeySize {
+			err = errors.New("wrong Ed25519 key size")
+		}
+		key.Key = ed25519.PublicKey(x)
+	default:
+		return Key{}, nil
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	// A key limited to another algorithm than its type implies isn't usable
+	if j.Alg != "" && j.Alg != key.Algorithm {
+		return Key{}, nil
+	}
+	return key, nil
+}
+
+func rsaKey(n, e string) (*rsa.PublicKey, error) {
+	nBytes, err := decode(n)
+	if err != nil {
+		return nil, err
+	}
+	eBytes, err := decode(e)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(eBytes)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("bad RSA exponent")
+	}
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: int(exponent.Int64())}
+	if key.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA key smaller than %d bits", minRSABits)
+	}
+	return key, nil
+}
+
+func ecKey(x, y string) (*ecdsa.PublicKey, error) {
+	xBytes, err := decode(x)
+	if err != nil {
+		return nil, err
+	}
+	yBytes, err := decode(y)
+	if err != nil {
+		return nil, err
+	}
+	if len(xBytes) != 32 || len(yBytes) != 32 {
+		return nil, errors.New("wrong P-256 coordinate size")
+	}
+	// The uncompressed point encoding, which NewPublicKey checks is on the
+	// curve
+	point := append(append([]byte{4}, xBytes...), yBytes...)
+	if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(xBytes),
+		Y:     new(big.Int).SetBytes(yBytes),
+	}, nil
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// JWKSFile is a KeySet read from a JWKS file on disk. It rereads the file
+// when it changes, so keys can be rotated by rewriting it: add the new key,
+// start signing with it, and remove the old one once its tokens expire. A
+// compromised key is revoked by removing it; writing an empty keys array
+// revokes them all.
+type JWKSFile struct {
+	// Logger reports files that fail to reload and keys that are skipped,
+	// slog.Default() when nil. When a reload fails, including when no key in
+	// the file is usable, the previous keys stay in use.
+	Logger *slog.Logger
+
+	path      string
+	mu        sync.Mutex
+	keys      []Key
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+// NewJWKSFile loads the key set at path.
+func NewJWKSFile(path string) (*JWKSFile, error) {
+	f := &JWKSFile{path: path}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload rereads the file if it changed since it was last read.
+func (f *JWKSFile) Reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	unchanged := info.ModTime().Equal(f.modTime)
+	f.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data, f.logger())
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys = keys
+	f.modTime = info.ModTime()
+	return nil
+}
+
+// Lookup checks for a new file at most once per second, so rotated keys are
+// picked up without restarting.
+func (f *JWKSFile) Lookup(id string) ([]Key, error) {
+	f.mu.Lock()
+	check := time.Since(f.lastCheck) >= jwksCheckInterval
+	if check {
+		f.lastCheck = time.Now()
+	}
+	f.mu.Unlock()
+
+	if check {
+		if err := f.Reload(); err != nil {
+			f.logger().Error("reloading JWKS", "path", f.path, "error", err)
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return lookup(f.keys, id), nil
+}
+
+func (f *JWKSFile) logger() *slog.Logger {
+	if f.Logger != nil {
+		return f.Logger
+	}
+	return slog.Default()
+}
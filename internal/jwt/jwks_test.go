@@ -0,0 +1,151 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// A JWKS document with the public halves of keys
+func jwksJSON(t *testing.T, keys testKeys, extra ...map[string]any) []byte {
+	t.Helper()
+	ecPub := keys.ecdsa.PublicKey
+	set := []map[string]any{
+		{"kty": "oct", "kid": "hs", "k": b64(keys.hmac)},
+		{"kty": "RSA", "kid": "rs", "alg": "RS256", "use": "sig",
+			"n": b64(keys.rsa.N.Bytes()), "e": b64(big.NewInt(int64(keys.rsa.E)).Bytes())},
+		{"kty": "EC", "kid": "es", "crv": "P-256", "x": b64(ecPub.X.FillBytes(make([]byte, 32))),
+			"y": b64(ecPub.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(keys.ed[32:])},
+	}
+	set = append(set, extra...)
+	data, err := json.Marshal(map[string]any{"keys": set})
+	require.NoError(t, err)
+	return data
+}
+
+func TestParseJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+
+	// Test: Every supported key type, skipping encryption keys, other curves
+	// and keys limited to other algorithms
+	parsed, err := ParseJWKS(jwksJSON(t, keys,
+		map[string]any{"kty": "oct", "kid": "enc", "use": "enc", "k": b64([]byte("x"))},
+		map[string]any{"kty": "EC", "kid": "p384", "crv": "P-384", "x": "", "y": ""},
+		map[string]any{"kty": "oct", "kid": "hs512", "alg": "HS512", "k": b64([]byte("x"))},
+	))
+	require.NoError(t, err)
+	require.Len(t, parsed, 4)
+	assert.Equal(t, Key{ID: "hs", Algorithm: HS256, Key: keys.hmac}, parsed[0])
+	assert.True(t, keys.rsa.PublicKey.Equal(parsed[1].Key.(*rsa.PublicKey)))
+	assert.True(t, keys.ecdsa.PublicKey.Equal(parsed[2].Key.(*ecdsa.PublicKey)))
+	assert.Equal(t, EdDSA, parsed[3].Algorithm)
+
+	// Test: Parsed keys verify tokens
+	v := NewVerifier(Options{Keys: StaticKeys(parsed)})
+	exp := time.Now().Add(time.Hour).Unix()
+	for _, token := range []string{
+		sign(t, RS256, "rs", keys.rsa, map[string]any{"sub": "a", "exp": exp}),
+		sign(t, ES256, "es", keys.ecdsa, map[string]any{"sub": "a", "exp": exp}),
+		sign(t, EdDSA, "ed", keys.ed, map[string]any{"sub": "a", "exp": exp}),
+	} {
+		_, err := v.Verify(token)
+		assert.NoError(t, err)
+	}
+
+	// Test: A malformed key is skipped and logged, the rest stay usable
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	parsed, err = ParseJWKS(jwksJSON(t, keys, map[string]any{"kty": "oct", "kid": "bad", "k": "not base64!"}))
+	require.NoError(t, err)
+	assert.Len(t, parsed, 4)
+	assert.Contains(t, logs.String(), "skipping JWKS key")
+	assert.Contains(t, logs.String(), "index=4")
+
+	// Test: Small RSA keys, points off the curve and bad encodings are errors
+	// when no usable key is left
+	for _, bad := range []map[string]any{
+		{"kty": "RSA", "n": b64(big.NewInt(3233).Bytes()), "e": "AQAB"},
+		{"kty": "EC", "crv": "P-256", "x": b64(make([]byte, 32)), "y": b64(make([]byte, 32))},
+		{"kty": "OKP", "crv": "Ed25519", "x": b64([]byte("short"))},
+		{"kty": "oct", "k": "not base64!"},
+	} {
+		data, _ := json.Marshal(map[string]any{"keys": []any{bad}})
+		_, err := ParseJWKS(data)
+		assert.Error(t, err, bad)
+	}
+	_, err = ParseJWKS([]byte("{"))
+	assert.Error(t, err)
+	_, err = ParseJWKS([]byte(`{"keys":[{"kty":"oct","use":"enc","k":"eA"}]}`))
+	assert.EqualError(t, err, "JWKS has no usable keys")
+	_, err = ParseJWKS([]byte(`{}`))
+	assert.Error(t, err)
+
+	// Test: An empty keys array is an empty set
+	parsed, err = ParseJWKS([]byte(`{"keys":[]}`))
+	require.NoError(t, err)
+	assert.Empty(t, parsed)
+}
+
+func TestJWKSFile(t *testing.T) {
+	oldKeys, newKeys := newTestKeys(t), newTestKeys(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwksJSON(t, oldKeys), 0o644))
+
+	file, err := NewJWKSFile(path)
+	require.NoError(t, err)
+	file.Logger = slog.New(slog.DiscardHandler)
+	v := NewVerifier(Options{Keys: file})
+	exp := time.Now().Add(time.Hour).Unix()
+	oldToken := sign(t, EdDSA, "ed", oldKeys.ed, map[string]any{"sub": "a", "exp": exp})
+	newToken := sign(t, EdDSA, "ed", newKeys.ed, map[string]any{"sub": "a", "exp": exp})
+
+	// Test: Keys from the file verify tokens
+	_, err = v.Verify(oldToken)
+	assert.NoError(t, err)
+	_, err = v.Verify(newToken)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Test: Rewriting the file rotates the keys on the next check
+	require.NoError(t, os.WriteFile(path, jwksJSON(t, newKeys), 0o644))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	file.lastCheck = time.Time{}
+	_, err = v.Verify(newToken)
+	assert.NoError(t, err)
+	_, err = v.Verify(oldToken)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Test: A broken file keeps the previous keys
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o644))
+	require.NoError(t, os.Chtimes(path, later.Add(time.Minute), later.Add(time.Minute)))
+	file.lastCheck = time.Time{}
+	_, err = v.Verify(newToken)
+	assert.NoError(t, err)
+
+	// Test: Emptying the keys array revokes every key
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys":[]}`), 0o644))
+	require.NoError(t, os.Chtimes(path, later.Add(2*time.Minute), later.Add(2*time.Minute)))
+	file.lastCheck = time.Time{}
+	_, err = v.Verify(newToken)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = NewJWKSFile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
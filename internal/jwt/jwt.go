@@ -0,0 +1,240 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"httpfromtcp/internal/auth"
+	"httpfromtcp/internal/server"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Clock skew tolerated on exp and nbf unless Options.Leeway is given
+const DefaultLeeway = time.Minute
+
+// Verification errors. Their messages are sent to the client in the
+// WWW-Authenticate error_description.
+var (
+	ErrMalformed            = errors.New("malformed token")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrInvalidSignature     = errors.New("invalid signature")
+	ErrExpired              = errors.New("token expired")
+	ErrMissingExpiry        = errors.New("token has no expiry")
+	ErrNotYetValid          = errors.New("token not yet valid")
+	ErrInvalidIssuer        = errors.New("invalid issuer")
+	ErrInvalidAudience      = errors.New("invalid audience")
+)
+
+type Options struct {
+	Keys KeySet
+	// Algorithms accepted, all supported ones when empty. Each key is only
+	// used with its own algorithm either way.
+	Algorithms []string
+	// Issuer and Audience the iss and aud claims must match, when set
+	Issuer   string
+	Audience string
+	// Leeway allowed on exp and nbf for clocks that disagree, DefaultLeeway
+	// when zero. Negative for none.
+	Leeway time.Duration
+	// AllowNoExpiry accepts tokens without an exp claim. They're refused
+	// otherwise, as they would stay valid forever.
+	AllowNoExpiry bool
+
+	// Realm sent in challenges by Middleware
+	Realm string
+	// Cookie names a cookie Middleware takes the token from when there's no
+	// Authorization header
+	Cookie string
+}
+
+// Claims are the claims of a verified token.
+type Claims map[string]any
+
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+func (c Claims) Issuer() string {
+	iss, _ := c["iss"].(string)
+	return iss
+}
+
+// Audience returns the aud claim, which may be a single string or a list.
+func (c Claims) Audience() []string {
+	switch aud := c["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		audience := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+		return audience
+	}
+	return nil
+}
+
+// ExpiresAt returns the exp claim, ok false if the token has none.
+func (c Claims) ExpiresAt() (time.Time, bool) {
+	return c.time("exp")
+}
+
+// NotBefore returns the nbf claim, ok false if the token has none.
+func (c Claims) NotBefore() (time.Time, bool) {
+	return c.time("nbf")
+}
+
+// Numeric dates are seconds since the epoch, possibly fractional
+func (c Claims) time(name string) (time.Time, bool) {
+	seconds, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(int64(seconds * 1000)), true
+}
+
+// Verifier checks compact JWS tokens. It implements auth.TokenValidator, so
+// it can be used with auth.Bearer directly.
+type Verifier struct {
+	opts Options
+	now  func() time.Time
+}
+
+func NewVerifier(opts Options) *Verifier {
+	if len(opts.Algorithms) == 0 {
+		opts.Algorithms = []string{HS256, RS256, ES256, EdDSA}
+	}
+	if opts.Leeway == 0 {
+		opts.Leeway = DefaultLeeway
+	}
+	opts.Leeway = max(opts.Leeway, 0)
+	return &Verifier{opts: opts, now: time.Now}
+}
+
+// Verify checks a token's signature and claims and returns the claims.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	var header struct {
+		Alg  string `json:"alg"`
+		Kid  string `json:"kid"`
+		Crit []any  `json:"crit"`
+	}
+	if err := decodeJSON(parts[0], &header); err != nil {
+		return nil, ErrMalformed
+	}
+	// "none" is never in the list, so unsigned tokens are refused here.
+	// Extensions we'd have to understand can't be honoured either.
+	if !slices.Contains(v.opts.Algorithms, header.Alg) || header.Crit != nil {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	signature, err := decode(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	keys, err := v.opts.Keys.Lookup(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range keys {
+		if key.Algorithm == header.Alg && key.verify(signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrInvalidSignature
+	}
+
+	var claims Claims
+	if err := decodeJSON(parts[1], &claims); err != nil || claims == nil {
+		return nil, ErrMalformed
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *Verifier) checkClaims(claims Claims) error {
+	now := v.now()
+	if _, ok := claims["exp"]; ok {
+		exp, ok := claims.ExpiresAt()
+		if !ok {
+			return ErrMalformed
+		}
+		if now.After(exp.Add(v.opts.Leeway)) {
+			return ErrExpired
+		}
+	} else if !v.opts.AllowNoExpiry {
+		return ErrMissingExpiry
+	}
+	if _, ok := claims["nbf"]; ok {
+		nbf, ok := claims.NotBefore()
+		if !ok {
+			return ErrMalformed
+		}
+		if now.Add(v.opts.Leeway).Before(nbf) {
+			return ErrNotYetValid
+		}
+	}
+
+	if v.opts.Issuer != "" && claims.Issuer() != v.opts.Issuer {
+		return ErrInvalidIssuer
+	}
+	if v.opts.Audience != "" && !slices.Contains(claims.Audience(), v.opts.Audience) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+// ValidateToken verifies the token and returns a principal named by its
+// subject, with the claims as attributes.
+func (v *Verifier) ValidateToken(_ context.Context, token string) (*auth.Principal, error) {
+	claims, err := v.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return &auth.Principal{Name: claims.Subject(), Attributes: claims}, nil
+}
+
+// Middleware requires a valid token in the Authorization header, or in
+// Options.Cookie. Requests without one are answered with 401 Unauthorized
+// and a Bearer challenge, others reach the handler with their claims
+// available from ClaimsFromContext.
+func Middleware(opts Options) server.Middleware {
+	return auth.Bearer(auth.BearerOptions{
+		Realm:     opts.Realm,
+		Validator: NewVerifier(opts),
+		Cookie:    opts.Cookie,
+	})
+}
+
+// ClaimsFromContext returns the claims of the token Middleware verified, or
+// nil if there isn't one.
+func ClaimsFromContext(ctx context.Context) Claims {
+	p := auth.FromContext(ctx)
+	if p == nil || p.Attributes == nil {
+		return nil
+	}
+	return Claims(p.Attributes)
+}
+
+func decodeJSON(s string, v any) error {
+	data, err := decode(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,204 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"httpfromtcp/internal/handlertest"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Signs claims into a compact JWS with the private key for alg
+func sign(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch alg {
+	case HS256:
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case RS256:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case ES256:
+		r, s, err := ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), digest[:])
+		require.NoError(t, err)
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	case EdDSA:
+		signature = ed25519.Sign(key.(ed25519.PrivateKey), []byte(signed))
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// Private keys for each algorithm and a key set with their public halves
+type testKeys struct {
+	hmac  []byte
+	rsa   *rsa.PrivateKey
+	ecdsa *ecdsa.PrivateKey
+	ed    ed25519.PrivateKey
+	set   StaticKeys
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	var k testKeys
+	var err error
+	k.hmac = []byte("a very secret shared key of 32 b")
+	k.rsa, err = rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	k.ecdsa, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, k.ed, err = ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	k.set = StaticKeys{
+		{ID: "hs", Algorithm: HS256, Key: k.hmac},
+		{ID: "rs", Algorithm: RS256, Key: &k.rsa.PublicKey},
+		{ID: "es", Algorithm: ES256, Key: &k.ecdsa.PublicKey},
+		{ID: "ed", Algorithm: EdDSA, Key: k.ed.Public()},
+	}
+	return k
+}
+
+func TestVerify(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Unix(1_700_000_000, 0)
+	v := NewVerifier(Options{Keys: keys.set, Issuer: "https://issuer.example", Audience: "api"})
+	v.now = func() time.Time { return now }
+	claims := func(extra map[string]any) map[string]any {
+		c := map[string]any{"sub": "alice", "iss": "https://issuer.example", "aud": "api", "exp": 1_700_000_600}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	// Test: Every algorithm verifies, with or without a kid
+	for _, tc := range []struct {
+		alg string
+		kid string
+		key any
+	}{
+		{HS256, "hs", keys.hmac},
+		{RS256, "rs", keys.rsa},
+		{ES256, "es", keys.ecdsa},
+		{EdDSA, "ed", keys.ed},
+		{EdDSA, "", keys.ed},
+	} {
+		got, err := v.Verify(sign(t, tc.alg, tc.kid, tc.key, claims(nil)))
+		require.NoError(t, err, tc.alg)
+		assert.Equal(t, "alice", got.Subject())
+		assert.Equal(t, []string{"api"}, got.Audience())
+	}
+
+	// Test: Tampered payloads, unknown kids and wrong keys are refused
+	token := sign(t, ES256, "es", keys.ecdsa, claims(nil))
+	parts := strings.Split(token, ".")
+	forged, _ := json.Marshal(claims(map[string]any{"sub": "mallory"}))
+	_, err := v.Verify(parts[0] + "." + base64.RawURLEncoding.EncodeToString(forged) + "." + parts[2])
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	_, err = v.Verify(sign(t, ES256, "other", keys.ecdsa, claims(nil)))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	_, err = v.Verify(sign(t, HS256, "hs", []byte("guessed"), claims(nil)))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Test: An RSA public key can't be used as an HMAC secret
+	modulus := keys.rsa.PublicKey.N.Bytes()
+	confused := NewVerifier(Options{Keys: StaticKeys{{ID: "rs", Algorithm: RS256, Key: &keys.rsa.PublicKey}}})
+	_, err = confused.Verify(sign(t, HS256, "rs", modulus, claims(nil)))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Test: Unsigned tokens, disallowed algorithms and crit are refused
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+	_, err = v.Verify(none)
+	assert.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+	hsOnly := NewVerifier(Options{Keys: keys.set, Algorithms: []string{HS256}})
+	_, err = hsOnly.Verify(token)
+	assert.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+	crit := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","crit":["exp"]}`)) + "." + parts[1] + "." + parts[2]
+	_, err = v.Verify(crit)
+	assert.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+
+	// Test: Malformed tokens
+	for _, bad := range []string{"", "a.b", "a.b.c.d", "!!.e30.sig", parts[0] + "." + parts[1] + ".!!"} {
+		_, err := v.Verify(bad)
+		assert.ErrorIs(t, err, ErrMalformed, bad)
+	}
+
+	// Test: exp and nbf allow for clock skew
+	check := func(extra map[string]any) error {
+		_, err := v.Verify(sign(t, HS256, "hs", keys.hmac, claims(extra)))
+		return err
+	}
+	assert.NoError(t, check(map[string]any{"exp": 1_700_000_000 - 30}))
+	assert.ErrorIs(t, check(map[string]any{"exp": 1_700_000_000 - 61}), ErrExpired)
+	assert.NoError(t, check(map[string]any{"nbf": 1_700_000_000 + 30}))
+	assert.ErrorIs(t, check(map[string]any{"nbf": 1_700_000_000 + 61}), ErrNotYetValid)
+	assert.ErrorIs(t, check(map[string]any{"exp": "tomorrow"}), ErrMalformed)
+
+	// Test: Tokens without exp are refused unless allowed
+	noExp := claims(nil)
+	delete(noExp, "exp")
+	token = sign(t, HS256, "hs", keys.hmac, noExp)
+	_, err = v.Verify(token)
+	assert.ErrorIs(t, err, ErrMissingExpiry)
+	lenient := NewVerifier(Options{Keys: keys.set, AllowNoExpiry: true})
+	_, err = lenient.Verify(token)
+	assert.NoError(t, err)
+
+	// Test: iss and aud must match, aud may be a list
+	assert.ErrorIs(t, check(map[string]any{"iss": "https://evil.example"}), ErrInvalidIssuer)
+	assert.ErrorIs(t, check(map[string]any{"aud": "other"}), ErrInvalidAudience)
+	assert.NoError(t, check(map[string]any{"aud": []string{"other", "api"}}))
+}
+
+func TestMiddleware(t *testing.T) {
+	keys := newTestKeys(t)
+	handler := Middleware(Options{Keys: keys.set, Cookie: "token"})(func(w *response.Writer, req *request.Request) {
+		claims := ClaimsFromContext(req.Context())
+		body := []byte(claims.Subject() + " " + claims["role"].(string))
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	})
+	serve := func(header string) (*http.Response, string) {
+		return handlertest.Serve(t, handler, handlertest.NewRequest(t, "GET", "/api", header, ""))
+	}
+	token := sign(t, EdDSA, "ed", keys.ed, map[string]any{"sub": "alice", "role": "admin", "exp": time.Now().Add(time.Hour).Unix()})
+
+	// Test: Token from the Authorization header or the cookie reaches the
+	// handler with its claims
+	_, body := serve("Authorization: Bearer " + token + "\r\n")
+	assert.Equal(t, "alice admin", body)
+	_, body = serve("Cookie: theme=dark; token=" + token + "\r\n")
+	assert.Equal(t, "alice admin", body)
+
+	// Test: Expired tokens get invalid_token with the reason
+	expired := sign(t, EdDSA, "ed", keys.ed, map[string]any{"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()})
+	res, _ := serve("Authorization: Bearer " + expired + "\r\n")
+	assert.Equal(t, 401, res.StatusCode)
+	assert.Contains(t, res.Header.Get("WWW-Authenticate"), `error="invalid_token", error_description="token expired"`)
+}
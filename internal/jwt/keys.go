@@ -0,0 +1,99 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"math/big"
+)
+
+// Signature algorithms from RFC 7518 and RFC 8037
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+// Smallest RSA modulus accepted, in bits
+const minRSABits = 2048
+
+// Key is a key that verifies signatures of one algorithm.
+type Key struct {
+	// ID matches the kid header of tokens signed with the key. Tokens
+	// without a kid are tried against every key.
+	ID        string
+	Algorithm string
+	// []byte for HS256, *rsa.PublicKey for RS256, *ecdsa.PublicKey on P-256
+	// for ES256 or ed25519.PublicKey for EdDSA
+	Key any
+}
+
+// KeySet finds the keys that may have signed a token.
+type KeySet interface {
+	// Lookup returns the keys with the given ID, or every key when id is
+	// empty
+	Lookup(id string) ([]Key, error)
+}
+
+// StaticKeys is a fixed KeySet.
+type StaticKeys []Key
+
+func (s StaticKeys) Lookup(id string) ([]Key, error) {
+	return lookup(s, id), nil
+}
+
+func lookup(keys []Key, id string) []Key {
+	if id == "" {
+		return keys
+	}
+	var found []Key
+	for _, key := range keys {
+		if key.ID == id {
+			found = append(found, key)
+		}
+	}
+	return found
+}
+
+// Reports whether signature is valid for signed under the key. The key's
+// type must match its algorithm, so an RSA public key can't be used as an
+// HMAC secret.
+func (k Key) verify(signed, signature []byte) bool {
+	digest := sha256.Sum256(signed)
+
+	switch k.Algorithm {
+	case HS256:
+		secret, ok := k.Key.([]byte)
+		if !ok || len(secret) == 0 {
+			return false
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+
+	case RS256:
+		pub, ok := k.Key.(*rsa.PublicKey)
+		return ok && pub.N.BitLen() >= minRSABits &&
+			rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+
+	case ES256:
+		pub, ok := k.Key.(*ecdsa.PublicKey)
+		// JWS signatures are r and s concatenated, not ASN.1
+		if !ok || pub.Curve != elliptic.P256() || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, digest[:], r, s)
+
+	case EdDSA:
+		pub, ok := k.Key.(ed25519.PublicKey)
+		return ok && len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, signed, signature)
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Buckets for request and response sizes in bytes
+var SizeBuckets = []float64{100, 1000, 10_000, 100_000, 1_000_000, 10_000_000}
+
+type HTTPOptions struct {
+	// Route names the route a request belongs to for the route label. It
+	// should map to a small, fixed set of names, since every distinct value
+	// creates new series. Nil uses the path of the request target.
+	Route func(req *request.Request) string
+}
+
+// HTTP records request and connection metrics for a server. Add its
+// Middleware to the handler chain and pass it to server.Observe.
+type HTTP struct {
+	opts HTTPOptions
+
+	requests     *Counter
+	duration     *Histogram
+	requestSize  *Histogram
+	responseSize *Histogram
+	activeConns  *Gauge
+	totalConns   *Counter
+	parseErrors  *Counter
+}
+
+// NewHTTP registers the HTTP metrics in reg.
+func NewHTTP(reg *Registry, opts HTTPOptions) *HTTP {
+	if opts.Route == nil {
+		opts.Route = pathRoute
+	}
+
+	return &HTTP{
+		opts: opts,
+		requests: reg.NewCounter("http_requests_total",
+			"Requests handled, by route, method and status.", "route", "method", "status"),
+		duration: reg.NewHistogram("http_request_duration_seconds",
+			"Time spent handling requests.", DefaultBuckets, "route", "method"),
+		requestSize: reg.NewHistogram("http_request_size_bytes",
+			"Size of request bodies.", SizeBuckets, "route", "method"),
+		responseSize: reg.NewHistogram("http_response_size_bytes",
+			"Size of response bodies as sent.", SizeBuckets, "route", "method"),
+		activeConns: reg.NewGauge("http_connections_active",
+			"Connections being served."),
+		totalConns: reg.NewCounter("http_connections_total",
+			"Connections accepted for serving."),
+		parseErrors: reg.NewCounter("http_request_parse_errors_total",
+			"Connections closed because their request couldn't be parsed."),
+	}
+}
+
+// Middleware records each request once its response is complete, with the
+// size counted by a response.Recorder. The duration only covers the
+// middleware after it, so it belongs near the front of the chain.
+func (m *HTTP) Middleware() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			route := m.opts.Route(req)
+			method := methodLabel(req.RequestLine.Method)
+			m.requestSize.Observe(float64(len(req.Body)), route, method)
+
+			rec := &response.Recorder{}
+			w.AddFilter(rec)
+			w.OnDone(func() {
+				m.duration.Observe(time.Since(start).Seconds(), route, method)
+				m.responseSize.Observe(float64(rec.BytesWritten), route, method)
+				m.requests.Inc(route, method, strconv.Itoa(int(rec.StatusCode)))
+			})
+			next(w, req)
+		}
+	}
+}
+
+func (m *HTTP) ConnOpened(net.Conn) {
+	m.totalConns.Inc()
+	m.activeConns.Inc()
+}
+
+func (m *HTTP) ConnClosed(net.Conn) {
+	m.activeConns.Dec()
+}
+
+func (m *HTTP) ParseError(net.Conn, error) {
+	m.parseErrors.Inc()
+}
+
+// The method label. Methods other than the standard ones are folded into
+// OTHER, as the parser accepts any token and each would add new series.
+func methodLabel(method string) string {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE":
+		return method
+	}
+	return "OTHER"
+}
+
+func pathRoute(req *request.Request) string {
+	path, _, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+	return path
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTP(t *testing.T) {
+	reg := NewRegistry()
+	m := NewHTTP(reg, HTTPOptions{})
+	handler := server.Chain(func(w *response.Writer, req *request.Request) {
+		body := []byte("hello")
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}, m.Middleware())
+	s, err := server.ListenAndServe("127.0.0.1:0", handler, server.Observe(m))
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	send := func(raw string) {
+		conn, err := net.Dial("tcp", s.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		conn.Write([]byte(raw))
+		io.Copy(io.Discard, bufio.NewReader(conn))
+	}
+
+	send("POST /items?page=2 HTTP/1.1\r\nHost: localhost\r\nContent-Length: 4\r\n\r\ndata")
+	send("GET /items HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	send("NOT A REQUEST\r\n\r\n")
+
+	exposition := func() string {
+		var out bytes.Buffer
+		reg.WriteTo(&out)
+		return out.String()
+	}
+	// Connections are untracked after the response is read
+	require.Eventually(t, func() bool {
+		return strings.Contains(exposition(), "http_connections_active 0\n")
+	}, time.Second, 10*time.Millisecond)
+	out := exposition()
+
+	// Test: Requests counted by route without the query, method and status
+	assert.Contains(t, out, `http_requests_total{route="/items",method="POST",status="200"} 1`)
+	assert.Contains(t, out, `http_requests_total{route="/items",method="GET",status="200"} 1`)
+
+	// Test: Request and response sizes and latency
+	assert.Contains(t, out, `http_request_size_bytes_sum{route="/items",method="POST"} 4`)
+	assert.Contains(t, out, `http_response_size_bytes_bucket{route="/items",method="GET",le="100"} 1`)
+	assert.Contains(t, out, `http_request_duration_seconds_count{route="/items",method="GET"} 1`)
+
+	// Test: Connections and parse errors come from the server
+	assert.Contains(t, out, "http_connections_total 3\n")
+	assert.Contains(t, out, "http_request_parse_errors_total 1\n")
+}
+
+func TestHTTPRoute(t *testing.T) {
+	reg := NewRegistry()
+	m := NewHTTP(reg, HTTPOptions{Route: func(*request.Request) string { return "api" }})
+
+	// Test: Custom route names replace the path
+	r, err := request.RequestFromReader(strings.NewReader("GET /users/42 HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	var resp bytes.Buffer
+	w := response.NewWriter(&resp)
+	m.Middleware()(func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusNotFound)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	})(w, r)
+	w.Finish()
+
+	var out bytes.Buffer
+	reg.WriteTo(&out)
+	assert.Contains(t, out.String(), `http_requests_total{route="api",method="GET",status="404"} 1`)
+
+	// Test: Methods clients make up share one series
+	for _, method := range []string{"BREW", "PROPFIND"} {
+		r, err := request.RequestFromReader(strings.NewReader(method + " /pot HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+		w := response.NewWriter(&resp)
+		m.Middleware()(func(w *response.Writer, req *request.Request) {
+			w.WriteStatusLine(response.StatusMethodNotAllowed)
+			w.WriteHeaders(response.GetDefaultHeaders(0))
+		})(w, r)
+		w.Finish()
+	}
+	out.Reset()
+	reg.WriteTo(&out)
+	assert.Contains(t, out.String(), `http_requests_total{route="api",method="OTHER",status="405"} 2`)
+	assert.NotContains(t, out.String(), "BREW")
+}
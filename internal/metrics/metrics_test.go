@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"bytes"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.NewCounter("requests_total", "Requests.\nBy path.", "path")
+	open := reg.NewGauge("open", "Open things.")
+	latency := reg.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "path")
+
+	requests.Inc("/b")
+	requests.Add(2, "/a")
+	requests.Inc(`/"q"\`)
+	open.Inc()
+	open.Inc()
+	open.Dec()
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.1, "/a")
+	latency.Observe(0.5, "/a")
+	latency.Observe(3, "/a")
+
+	var out bytes.Buffer
+	n, err := reg.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Equal(t, int64(out.Len()), n)
+
+	// Test: Metrics in registration order, series sorted, histogram buckets
+	// cumulative, help and label values escaped
+	assert.Equal(t, `# HELP requests_total Requests.\nBy path.
+# TYPE requests_total counter
+requests_total{path="/\"q\"\\"} 1
+requests_total{path="/a"} 2
+requests_total{path="/b"} 1
+# HELP open Open things.
+# TYPE open gauge
+open 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{path="/a",le="0.1"} 2
+latency_seconds_bucket{path="/a",le="1"} 3
+latency_seconds_bucket{path="/a",le="+Inf"} 4
+latency_seconds_sum{path="/a"} 3.65
+latency_seconds_count{path="/a"} 4
+`, out.String())
+
+	// Test: Wrong number of label values, duplicate names and decreasing
+	// counters panic
+	assert.Panics(t, func() { requests.Inc() })
+	assert.Panics(t, func() { reg.NewGauge("open", "Again.") })
+	assert.Panics(t, func() { requests.Add(-1, "/a") })
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("hits_total", "Hits.").Inc()
+
+	serve := func(method string) string {
+		req, err := request.RequestFromReader(strings.NewReader(method + " /metrics HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+		var out bytes.Buffer
+		w := response.NewWriter(&out)
+		reg.Handler()(w, req)
+		w.Finish()
+		return out.String()
+	}
+
+	// Test: Exposition format body and content type
+	out := serve("GET")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, out, "Content-Type: "+ContentType+"\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n# HELP hits_total Hits.\n# TYPE hits_total counter\nhits_total 1\n"))
+
+	// Test: HEAD has the headers only
+	out = serve("HEAD")
+	assert.Contains(t, out, "Content-Length: 63\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"))
+}
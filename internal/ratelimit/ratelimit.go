@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit describes a token bucket. It holds Burst tokens and refills at
+// Requests per Period, and each request takes one token.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	// Requests allowed at once after a quiet spell, zero selects Requests
+	Burst int
+}
+
+// ErrInvalidLimit means a Limit's Requests or Period isn't positive, so its
+// bucket would never refill.
+var ErrInvalidLimit = errors.New("ratelimit: invalid limit")
+
+// KeyFunc picks the bucket a request draws from. Requests with an empty key
+// aren't limited.
+type KeyFunc func(req *request.Request) string
+
+type Options struct {
+	Limit Limit
+	// Key selects the bucket for each request, ByIP when nil
+	Key KeyFunc
+	// Store holds the buckets, a new MemoryStore when nil
+	Store Store
+}
+
+// Middleware limits requests with a token bucket per key. Requests over the
+// limit are answered with 429 Too Many Requests and a Retry-After header, and
+// every limited response carries RateLimit-* headers describing the bucket.
+// It fails with ErrInvalidLimit if the limit would never refill.
+func Middleware(opts Options) (server.Middleware, error) {
+	if opts.Limit.Requests <= 0 || opts.Limit.Period <= 0 {
+		return nil, fmt.Errorf("%w: %d requests per %s", ErrInvalidLimit, opts.Limit.Requests, opts.Limit.Period)
+	}
+	if opts.Key == nil {
+		opts.Key = ByIP
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			key := opts.Key(req)
+			if key == "" {
+				next(w, req)
+				return
+			}
+
+			result, err := opts.Store.Take(key, opts.Limit, time.Now())
+			if err != nil {
+				// A store that's down shouldn't take the site down with it
+				slog.Default().Error("taking rate limit token", "key", key, "error", err)
+				next(w, req)
+				return
+			}
+
+			if !result.Allowed {
+				writeLimited(w, opts.Limit, result)
+				return
+			}
+			w.AddFilter(&filter{limit: opts.Limit, result: result})
+			next(w, req)
+		}
+	}, nil
+}
+
+// ByIP keys requests by the client's IP address.
+func ByIP(req *request.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// ByHeader keys requests by the value of a header, such as an API key.
+// Requests without the header aren't limited.
+func ByHeader(name string) KeyFunc {
+	return func(req *request.Request) string {
+		value, _ := req.Headers.Get(name)
+		return value
+	}
+}
+
+// ByRoute keys requests by their path, so each route has a single bucket
+// shared by all clients.
+func ByRoute(req *request.Request) string {
+	path, _, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+	return path
+}
+
+// Adds the RateLimit-* headers to a response that was allowed through
+type filter struct {
+	limit  Limit
+	result Result
+}
+
+func (f *filter) Headers(_ response.StatusCode, h headers.Headers) {
+	setHeaders(h, f.limit, f.result)
+}
+
+func (f *filter) Body(io.Writer) io.WriteCloser {
+	return nil
+}
+
+func writeLimited(w *response.Writer, limit Limit, result Result) {
+	status := response.StatusTooManyRequests
+	body := []byte(fmt.Sprintf("%d %s\n", status, response.StatusText(status)))
+	h := response.GetDefaultHeaders(len(body))
+	setHeaders(h, limit, result)
+	h.Set("Retry-After", strconv.Itoa(max(seconds(result.RetryAfter), 1)))
+
+	w.WriteStatusLine(status)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+func setHeaders(h headers.Headers, limit Limit, result Result) {
+	// The bucket holds burst tokens, which is what a client can use at once
+	h.Replace("RateLimit-Limit", strconv.Itoa(limit.burst()))
+	h.Replace("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	h.Replace("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+	h.Replace("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, seconds(limit.Period)))
+}
+
+// Whole seconds, rounded up so clients don't retry too early
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
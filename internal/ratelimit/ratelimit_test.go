@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"errors"
+	"httpfromtcp/internal/handlertest"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/server"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	handler := newHandler(t, Options{Limit: Limit{Requests: 2, Period: time.Minute}})
+
+	// Test: Requests within the limit carry RateLimit headers
+	res, _ := handlertest.Serve(t, handler, newRequest(t, "10.0.0.1:5000", ""))
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get("RateLimit-Limit"))
+	assert.Equal(t, "1", res.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", res.Header.Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", res.Header.Get("RateLimit-Policy"))
+	res, _ = handlertest.Serve(t, handler, newRequest(t, "10.0.0.1:5001", ""))
+	assert.Equal(t, "0", res.Header.Get("RateLimit-Remaining"))
+
+	// Test: Request over the limit gets 429 with Retry-After
+	res, _ = handlertest.Serve(t, handler, newRequest(t, "10.0.0.1:5002", ""))
+	assert.Equal(t, 429, res.StatusCode)
+	assert.Equal(t, "30", res.Header.Get("Retry-After"))
+	assert.Equal(t, "0", res.Header.Get("RateLimit-Remaining"))
+
+	// Test: Other client IPs have their own bucket
+	res, _ = handlertest.Serve(t, handler, newRequest(t, "10.0.0.2:5000", ""))
+	assert.Equal(t, 200, res.StatusCode)
+
+	// Test: The limit reported is the bucket size, so Remaining never
+	// exceeds it
+	handler = newHandler(t, Options{Limit: Limit{Requests: 2, Period: time.Minute, Burst: 5}})
+	res, _ = handlertest.Serve(t, handler, newRequest(t, "10.0.0.3:5000", ""))
+	assert.Equal(t, "5", res.Header.Get("RateLimit-Limit"))
+	assert.Equal(t, "4", res.Header.Get("RateLimit-Remaining"))
+
+	// Test: Limits that never refill are refused
+	_, err := Middleware(Options{Limit: Limit{Requests: 2}})
+	assert.ErrorIs(t, err, ErrInvalidLimit)
+	_, err = Middleware(Options{Limit: Limit{Period: time.Minute}})
+	assert.ErrorIs(t, err, ErrInvalidLimit)
+}
+
+func TestMiddlewareKeys(t *testing.T) {
+	// Test: Keyed by API key header, requests without it aren't limited
+	handler := newHandler(t, Options{
+		Limit: Limit{Requests: 1, Period: time.Second},
+		Key:   ByHeader("X-API-Key"),
+	})
+	assert.Equal(t, 200, status(t, handler, newRequest(t, "10.0.0.1:1", "X-API-Key: abc\r\n")))
+	assert.Equal(t, 429, status(t, handler, newRequest(t, "10.0.0.2:1", "X-API-Key: abc\r\n")))
+	assert.Equal(t, 200, status(t, handler, newRequest(t, "10.0.0.1:1", "X-API-Key: def\r\n")))
+	assert.Equal(t, 200, status(t, handler, newRequest(t, "10.0.0.1:1", "")))
+	assert.Equal(t, 200, status(t, handler, newRequest(t, "10.0.0.1:1", "")))
+
+	// Test: Keyed by route, ignoring the query
+	req := newRequest(t, "10.0.0.1:1", "")
+	req.RequestLine.RequestTarget = "/search?q=go"
+	assert.Equal(t, "/search", ByRoute(req))
+
+	// Test: Failing store lets requests through
+	handler = newHandler(t, Options{Limit: Limit{Requests: 1, Period: time.Second}, Store: failingStore{}})
+	assert.Equal(t, 200, status(t, handler, newRequest(t, "10.0.0.1:1", "")))
+	assert.Equal(t, 200, status(t, handler, newRequest(t, "10.0.0.1:1", "")))
+}
+
+func status(t *testing.T, handler server.Handler, req *request.Request) int {
+	t.Helper()
+
+	res, _ := handlertest.Serve(t, handler, req)
+	return res.StatusCode
+}
+
+func newHandler(t *testing.T, opts Options) server.Handler {
+	t.Helper()
+
+	mw, err := Middleware(opts)
+	require.NoError(t, err)
+	return mw(handlertest.OK)
+}
+
+// A GET request from the client at remoteAddr
+func newRequest(t *testing.T, remoteAddr, header string) *request.Request {
+	t.Helper()
+
+	req := handlertest.NewRequest(t, "GET", "/", header, "")
+	req.RemoteAddr = remoteAddr
+	return req
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(string, Limit, time.Time) (Result, error) {
+	return Result{}, errors.New("store unavailable")
+}
@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// How often MemoryStore looks for buckets it can drop
+const sweepInterval = time.Minute
+
+// Store keeps token buckets by key. A store shared between processes, such as
+// one backed by Redis, lets several servers enforce one limit. Stores must be
+// safe for concurrent use.
+type Store interface {
+	// Take refills the key's bucket for the time passed since it was last
+	// used, then takes a token from it if one is available.
+	Take(key string, limit Limit, now time.Time) (Result, error)
+}
+
+type Result struct {
+	Allowed bool
+	// Tokens left in the bucket
+	Remaining int
+	// Time until the bucket is full again
+	Reset time.Duration
+	// Time until the next token is available, zero when one is left
+	RetryAfter time.Duration
+}
+
+// MemoryStore keeps buckets in memory. Buckets that have refilled completely
+// are no different from new ones, so they're dropped to keep idle clients
+// from using memory.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   map[string]*bucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemoryStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.burst()), last: now}
+		m.buckets[key] = b
+	}
+	b.limit = limit
+	b.refill(now)
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	rate := limit.rate()
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(b.tokens),
+		Reset:     refillTime(float64(limit.burst())-b.tokens, rate),
+	}
+	if !allowed {
+		result.RetryAfter = refillTime(1-b.tokens, rate)
+	}
+	return result, nil
+}
+
+// Drop every bucket that has refilled completely
+func (m *MemoryStore) sweep(now time.Time) {
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.burst()) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.burst()), b.tokens+elapsed*b.limit.rate())
+		b.last = now
+	}
+}
+
+// Tokens added per second
+func (l Limit) rate() float64 {
+	if l.Period <= 0 {
+		return 0
+	}
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Bucket size, defaulting to Requests
+func (l Limit) burst() int {
+	if l.Burst <= 0 {
+		return l.Requests
+	}
+	return l.Burst
+}
+
+// How long it takes to add tokens at rate
+func refillTime(tokens, rate float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	if rate <= 0 {
+		return math.MaxInt64
+	}
+	return time.Duration(tokens / rate * float64(time.Second))
+}
@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 10, Period: 10 * time.Second, Burst: 3}
+	now := time.Now()
+
+	// Test: Burst is available at once
+	for want := 2; want >= 0; want-- {
+		result, err := store.Take("a", limit, now)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, want, result.Remaining)
+	}
+
+	// Test: Empty bucket refuses and says when a token is due
+	result, _ := store.Take("a", limit, now)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 3*time.Second, result.Reset)
+
+	// Test: Tokens refill at the limit's rate
+	result, _ = store.Take("a", limit, now.Add(1500*time.Millisecond))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// Test: Refill stops at the burst size
+	result, _ = store.Take("a", limit, now.Add(time.Hour))
+	assert.Equal(t, 2, result.Remaining)
+
+	// Test: Refilled buckets are dropped by the sweep, busy ones kept
+	store.Take("b", Limit{Requests: 1, Period: time.Hour}, now.Add(time.Hour))
+	store.Take("c", limit, now.Add(time.Hour+sweepInterval))
+	assert.Len(t, store.buckets, 2)
+	assert.Contains(t, store.buckets, "b")
+	assert.NotContains(t, store.buckets, "a")
+}
@@ -2,7 +2,11 @@ package request
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"httpfromtcp/internal/cookie"
 	"httpfromtcp/internal/headers"
 	"io"
 	"strconv"
@@ -11,6 +15,10 @@ import (
 
 const bufferSize = 8
 
+// ErrBodyTooLarge is returned for requests whose Content-Length is over the
+// limit given to RequestFromReaderLimit.
+var ErrBodyTooLarge = errors.New("request body too large")
+
 type RequestState int
 
 const (
@@ -26,6 +34,14 @@ type Request struct {
 	Body          []byte
 	ContentLength int
 	State         RequestState
+	// Network address of the client, set by the server
+	RemoteAddr string
+	// Set for requests received over TLS, for checking the negotiated
+	// version and cipher or authorizing client certificates
+	TLS *tls.ConnectionState
+	ctx context.Context
+	// Largest Content-Length accepted, zero for any
+	maxBodySize int
 }
 
 type RequestLine struct {
@@ -34,16 +50,74 @@ type RequestLine struct {
 	Method        string
 }
 
+// Context returns the request's context. For requests received by the server
+// it's cancelled when the client disconnects, a response write fails or the
+// server shuts down.
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+// WithContext returns a shallow copy of the request with its context
+// replaced by ctx.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
+// WithValue returns a shallow copy of the request carrying a request-scoped
+// value under key, retrieved with Value.
+func (r *Request) WithValue(key, value any) *Request {
+	return r.WithContext(context.WithValue(r.Context(), key, value))
+}
+
+// Value returns the request-scoped value stored under key, or nil.
+func (r *Request) Value(key any) any {
+	return r.Context().Value(key)
+}
+
+// Cookies returns the cookies sent in the Cookie header.
+func (r *Request) Cookies() []*cookie.Cookie {
+	header, ok := r.Headers.Get("Cookie")
+	if !ok {
+		return nil
+	}
+	return cookie.Parse(header)
+}
+
+// Cookie returns the first cookie with the given name, ok false if there
+// isn't one.
+func (r *Request) Cookie(name string) (*cookie.Cookie, bool) {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// RequestFromReader reads a request, however large its body.
 func RequestFromReader(reader io.Reader) (*Request, error) {
+	return RequestFromReaderLimit(reader, 0)
+}
+
+// RequestFromReaderLimit reads a request, failing with ErrBodyTooLarge
+// before reading a body whose Content-Length exceeds maxBodySize. Zero
+// means no limit.
+func RequestFromReaderLimit(reader io.Reader, maxBodySize int) (*Request, error) {
 	// Create a buffer to read data into
 	buf := make([]byte, bufferSize)
 	readToIndex := 0
 
 	// Create a new Request in the Initialized state
 	req := &Request{
-		State:   Initialized,
-		Headers: map[string]string{},
-		Body:    make([]byte, 0),
+		State:       Initialized,
+		Headers:     map[string]string{},
+		Body:        make([]byte, 0),
+		maxBodySize: maxBodySize,
 	}
 
 	for req.State != Done {
@@ -62,6 +136,10 @@ func RequestFromReader(reader io.Reader) (*Request, error) {
 
 		// If we read 0 bytes and got EOF we're done
 		if br == 0 && err == io.EOF {
+			// A connection closed before the headers ended isn't a request
+			if req.State != ParsingBody {
+				return nil, fmt.Errorf("incomplete request: %w", io.ErrUnexpectedEOF)
+			}
 			// Check for valid content length
 			if req.ContentLength > 0 && len(req.Body) < req.ContentLength {
 				return nil, fmt.Errorf("request body smaller than specified content length")
@@ -131,9 +209,11 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		if err != nil {
 			return 0, err
 		}
-		// If headers are completely parsed set the request state to parsing body
+		// If headers are completely parsed set the request state to parsing
+		// body and consume the CRLF that ends the header section
 		if done {
 			r.State = ParsingBody
+			bc += len("\r\n")
 		}
 		// Return the total bytes consumed
 		return bc, nil
@@ -149,6 +229,10 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		if err != nil {
 			return 0, err
 		}
+		// Refuse an oversized body before buffering any of it
+		if r.maxBodySize > 0 && cl > r.maxBodySize {
+			return 0, ErrBodyTooLarge
+		}
 		// Set the content length to the header value and the
 		// body to the remaining data minus the leading "\r\n"
 		r.ContentLength = cl
@@ -160,10 +244,10 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		// If body equals specified content length we're done
 		if len(r.Body) == r.ContentLength {
 			r.State = Done
-			return 0, nil
+			return len(data), nil
 		}
-		// We need more data
-		return 0, nil
+		// Consume the data and wait for more
+		return len(data), nil
 	case Done:
 		// If the request is done, something went wrong
 		return 0, fmt.Errorf("trying to read data in a done state")
@@ -65,6 +65,14 @@ func TestRequestLineHeadersParse(t *testing.T) {
 	}
 	r, err = RequestFromReader(reader)
 	require.Error(t, err)
+
+	// Test: Connection closed before the headers end
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
 }
 
 func TestRequestBodyParse(t *testing.T) {
@@ -117,6 +125,18 @@ func TestRequestBodyParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
+
+	// Test: Body over the limit is refused, one at the limit is read
+	body := "POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Length: 13\r\n" +
+		"\r\n" +
+		"hello world!\n"
+	_, err = RequestFromReaderLimit(&chunkReader{data: body, numBytesPerRead: 3}, 12)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+	r, err = RequestFromReaderLimit(&chunkReader{data: body, numBytesPerRead: 3}, 13)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(r.Body))
 }
 
 type chunkReader struct {
@@ -143,3 +163,24 @@ func (cr *chunkReader) Read(p []byte) (n int, err error) {
 	}
 	return n, nil
 }
+
+func TestRequestCookies(t *testing.T) {
+	// Test: Cookies from repeated Cookie fields, in order
+	reader := &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nCookie: theme=dark; session=\"abc\"\r\nCookie: lang=en\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	var names []string
+	for _, c := range r.Cookies() {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"theme", "session", "lang"}, names)
+
+	c, ok := r.Cookie("session")
+	require.True(t, ok)
+	assert.Equal(t, "abc", c.Value)
+	_, ok = r.Cookie("missing")
+	assert.False(t, ok)
+}
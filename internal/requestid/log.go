@@ -0,0 +1,35 @@
+package requestid
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Attribute key of the request ID in log records
+const LogKey = "request_id"
+
+// NewLogHandler wraps h so records logged with a request's context, such as
+// by slog.InfoContext(req.Context(), ...), carry its ID.
+func NewLogHandler(h slog.Handler) slog.Handler {
+	return &logHandler{h}
+}
+
+type logHandler struct {
+	slog.Handler
+}
+
+func (h *logHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := FromContext(ctx); id != "" {
+		r = r.Clone()
+		r.AddAttrs(slog.String(LogKey, id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &logHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	return &logHandler{h.Handler.WithGroup(name)}
+}
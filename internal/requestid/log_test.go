@@ -0,0 +1,36 @@
+package requestid
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"httpfromtcp/internal/request"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogHandler(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewJSONHandler(&logs, nil))).With("component", "proxy")
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	req = req.WithValue(contextKey{}, "abc123")
+
+	// Test: Records logged with the request context are tagged
+	logger.InfoContext(req.Context(), "upstream failed")
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &record))
+	assert.Equal(t, "abc123", record[LogKey])
+	assert.Equal(t, "proxy", record["component"])
+
+	// Test: Records without a request aren't
+	logs.Reset()
+	logger.InfoContext(context.Background(), "started")
+	record = nil
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &record))
+	assert.NotContains(t, record, LogKey)
+}
@@ -0,0 +1,100 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+)
+
+// Header carrying the request ID unless Options.Header is given
+const DefaultHeader = "X-Request-ID"
+
+// Incoming IDs longer than this are replaced, so clients can't bloat logs
+const MaxLength = 128
+
+type Options struct {
+	// Header to read the incoming ID from and echo it in, DefaultHeader when
+	// empty
+	Header string
+	// Generate returns a new ID when the request has no valid one, 32 random
+	// hex digits when nil
+	Generate func() string
+}
+
+type contextKey struct{}
+
+// Middleware gives each request an ID: the one the client or a proxy sent,
+// if it's valid, or a new one. The ID is in the request context for
+// FromContext and NewLogHandler, and echoed in the response headers. It
+// should come before any middleware that logs.
+func Middleware(opts Options) server.Middleware {
+	if opts.Header == "" {
+		opts.Header = DefaultHeader
+	}
+	if opts.Generate == nil {
+		opts.Generate = generate
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			id, ok := req.Headers.Get(opts.Header)
+			if !ok || !Valid(id) {
+				id = opts.Generate()
+			}
+
+			w.AddFilter(&echoFilter{header: opts.Header, id: id})
+			next(w, req.WithValue(contextKey{}, id))
+		}
+	}
+}
+
+// FromContext returns the ID Middleware gave the request, or "" outside of
+// one.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Valid reports whether an incoming ID can be used as is: 1 to MaxLength
+// letters, digits and -_.:+/= so UUIDs and base64 IDs pass but nothing that
+// could break a log line does.
+func Valid(id string) bool {
+	if id == "" || len(id) > MaxLength {
+		return false
+	}
+	for _, c := range []byte(id) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':' || c == '+' || c == '/' || c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func generate() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Sets the ID on the response, replacing any the handler copied from the
+// request
+type echoFilter struct {
+	header string
+	id     string
+}
+
+func (f *echoFilter) Headers(_ response.StatusCode, h headers.Headers) {
+	h.Replace(f.header, f.id)
+}
+
+func (f *echoFilter) Body(io.Writer) io.WriteCloser {
+	return nil
+}
@@ -0,0 +1,59 @@
+package requestid
+
+import (
+	"bytes"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	var seen string
+	handler := Middleware(Options{Generate: func() string { return "generated" }})(
+		func(w *response.Writer, req *request.Request) {
+			seen = FromContext(req.Context())
+			headers := response.GetDefaultHeaders(0)
+			// A handler copying the request header doesn't duplicate it
+			headers.Set("X-Request-ID", "from-handler")
+			w.WriteStatusLine(response.StatusOK)
+			w.WriteHeaders(headers)
+		})
+	serve := func(raw string) string {
+		req, err := request.RequestFromReader(strings.NewReader(raw))
+		require.NoError(t, err)
+		var out bytes.Buffer
+		handler(response.NewWriter(&out), req)
+		return out.String()
+	}
+
+	// Test: Valid incoming ID is kept and echoed
+	out := serve("GET / HTTP/1.1\r\nHost: localhost\r\nX-Request-ID: 3f2a-b7:c9=\r\n\r\n")
+	assert.Equal(t, "3f2a-b7:c9=", seen)
+	assert.Contains(t, out, "\r\nX-Request-ID: 3f2a-b7:c9=\r\n")
+	assert.NotContains(t, out, "from-handler")
+
+	// Test: Missing, too long and unsafe IDs are replaced
+	for _, header := range []string{
+		"",
+		"X-Request-ID: " + strings.Repeat("a", MaxLength+1) + "\r\n",
+		"X-Request-ID: a b\r\n",
+		"X-Request-ID: id\"><script>\r\n",
+	} {
+		out := serve("GET / HTTP/1.1\r\nHost: localhost\r\n" + header + "\r\n")
+		assert.Equal(t, "generated", seen)
+		assert.Contains(t, out, "\r\nX-Request-ID: generated\r\n")
+	}
+	assert.True(t, Valid(strings.Repeat("a", MaxLength)))
+}
+
+func TestGenerate(t *testing.T) {
+	// Test: Generated IDs are unique and valid
+	a, b := generate(), generate()
+	assert.Len(t, a, 32)
+	assert.NotEqual(t, a, b)
+	assert.True(t, Valid(a))
+}
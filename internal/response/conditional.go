@@ -0,0 +1,172 @@
+package response
+
+import (
+	"httpfromtcp/internal/request"
+	"strings"
+	"time"
+)
+
+type conditionResult int
+
+const (
+	conditionNone conditionResult = iota
+	conditionTrue
+	conditionFalse
+)
+
+// CheckPreconditions evaluates If-Match, If-Unmodified-Since, If-None-Match
+// and If-Modified-Since in the order given by RFC 9110 section 13.2.2 against
+// the current representation's entity tag and modification time, either of
+// which may be empty. If the request can't proceed it writes 304 Not Modified
+// or 412 Precondition Failed and returns true, in which case the handler must
+// not write anything else.
+func CheckPreconditions(w *Writer, req *request.Request, etag string, modtime time.Time) bool {
+	method := req.RequestLine.Method
+
+	ch := checkIfMatch(req, etag)
+	if ch == conditionNone {
+		ch = checkIfUnmodifiedSince(req, modtime)
+	}
+	if ch == conditionFalse {
+		writeConditionFailed(w, StatusPreconditionFailed, etag, modtime)
+		return true
+	}
+
+	switch checkIfNoneMatch(req, etag) {
+	case conditionFalse:
+		if method == "GET" || method == "HEAD" {
+			writeConditionFailed(w, StatusNotModified, etag, modtime)
+		} else {
+			writeConditionFailed(w, StatusPreconditionFailed, etag, modtime)
+		}
+		return true
+	case conditionNone:
+		if (method == "GET" || method == "HEAD") && checkIfModifiedSince(req, modtime) == conditionFalse {
+			writeConditionFailed(w, StatusNotModified, etag, modtime)
+			return true
+		}
+	}
+
+	return false
+}
+
+func checkIfMatch(req *request.Request, etag string) conditionResult {
+	value, ok := req.Headers.Get("If-Match")
+	if !ok {
+		return conditionNone
+	}
+
+	for _, tag := range parseETags(value) {
+		if tag == "*" || strongMatch(tag, etag) {
+			return conditionTrue
+		}
+	}
+	return conditionFalse
+}
+
+func checkIfUnmodifiedSince(req *request.Request, modtime time.Time) conditionResult {
+	value, ok := req.Headers.Get("If-Unmodified-Since")
+	if !ok || modtime.IsZero() {
+		return conditionNone
+	}
+
+	t, err := time.Parse(TimeFormat, value)
+	if err != nil {
+		return conditionNone
+	}
+	if modtime.Truncate(time.Second).After(t) {
+		return conditionFalse
+	}
+	return conditionTrue
+}
+
+func checkIfNoneMatch(req *request.Request, etag string) conditionResult {
+	value, ok := req.Headers.Get("If-None-Match")
+	if !ok {
+		return conditionNone
+	}
+
+	for _, tag := range parseETags(value) {
+		if tag == "*" || weakMatch(tag, etag) {
+			return conditionFalse
+		}
+	}
+	return conditionTrue
+}
+
+func checkIfModifiedSince(req *request.Request, modtime time.Time) conditionResult {
+	value, ok := req.Headers.Get("If-Modified-Since")
+	if !ok || modtime.IsZero() {
+		return conditionNone
+	}
+
+	t, err := time.Parse(TimeFormat, value)
+	if err != nil {
+		return conditionNone
+	}
+	if modtime.Truncate(time.Second).After(t) {
+		return conditionTrue
+	}
+	return conditionFalse
+}
+
+// Split a comma-separated list of entity tags. Commas are valid inside the
+// quoted part of a tag so the list can't simply be split on them.
+func parseETags(value string) []string {
+	var tags []string
+	for {
+		value = strings.TrimLeft(value, " \t,")
+		if value == "" {
+			return tags
+		}
+		if value[0] == '*' {
+			tags = append(tags, "*")
+			value = value[1:]
+			continue
+		}
+
+		start := 0
+		if strings.HasPrefix(value, "W/") {
+			start = 2
+		}
+		if len(value) <= start || value[start] != '"' {
+			return tags
+		}
+		end := strings.IndexByte(value[start+1:], '"')
+		if end == -1 {
+			return tags
+		}
+		end += start + 2
+		tags = append(tags, value[:end])
+		value = value[end:]
+	}
+}
+
+// Two entity tags match strongly if neither is weak and they are identical.
+func strongMatch(a, b string) bool {
+	return a != "" && a == b && !strings.HasPrefix(a, "W/")
+}
+
+// Two entity tags match weakly if their opaque parts are identical.
+func weakMatch(a, b string) bool {
+	return a != "" && strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// Write a response without a body for a failed condition. Validators are
+// included so a client receiving 304 can refresh its cached copy.
+func writeConditionFailed(w *Writer, status StatusCode, etag string, modtime time.Time) {
+	headers := GetDefaultHeaders(0)
+	headers.Remove("Content-Type")
+	if status == StatusNotModified {
+		headers.Remove("Content-Length")
+	}
+	if etag != "" {
+		headers.Set("ETag", etag)
+	}
+	if !modtime.IsZero() {
+		headers.Set("Last-Modified", modtime.UTC().Format(TimeFormat))
+	}
+
+	w.WriteStatusLine(status)
+	w.WriteHeaders(headers)
+}
@@ -0,0 +1,101 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"httpfromtcp/internal/request"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPreconditions(t *testing.T) {
+	// Test: No conditional headers
+	done, _ := checkPreconditions(t, "GET", "")
+	assert.False(t, done)
+
+	// Test: If-None-Match with the current entity tag
+	done, res := checkPreconditions(t, "GET", "If-None-Match: \"v1\"\r\n")
+	require.True(t, done)
+	assert.Equal(t, 304, res.StatusCode)
+	assert.Equal(t, "\"v1\"", res.Header.Get("ETag"))
+	assert.Equal(t, "Sun, 01 Jun 2025 12:00:00 GMT", res.Header.Get("Last-Modified"))
+
+	// Test: If-None-Match compares weakly and handles lists and wildcards
+	done, res = checkPreconditions(t, "GET", "If-None-Match: \"a,b\", W/\"v1\"\r\n")
+	require.True(t, done)
+	assert.Equal(t, 304, res.StatusCode)
+	done, res = checkPreconditions(t, "HEAD", "If-None-Match: *\r\n")
+	require.True(t, done)
+	assert.Equal(t, 304, res.StatusCode)
+	done, _ = checkPreconditions(t, "GET", "If-None-Match: \"v0\"\r\n")
+	assert.False(t, done)
+
+	// Test: If-None-Match on an unsafe method fails the precondition
+	done, res = checkPreconditions(t, "PUT", "If-None-Match: *\r\n")
+	require.True(t, done)
+	assert.Equal(t, 412, res.StatusCode)
+
+	// Test: If-Modified-Since
+	done, res = checkPreconditions(t, "GET", "If-Modified-Since: Sun, 01 Jun 2025 12:00:00 GMT\r\n")
+	require.True(t, done)
+	assert.Equal(t, 304, res.StatusCode)
+	done, _ = checkPreconditions(t, "GET", "If-Modified-Since: Sat, 31 May 2025 12:00:00 GMT\r\n")
+	assert.False(t, done)
+	done, _ = checkPreconditions(t, "GET", "If-Modified-Since: yesterday\r\n")
+	assert.False(t, done)
+
+	// Test: If-None-Match takes precedence over If-Modified-Since
+	done, _ = checkPreconditions(t, "GET", "If-None-Match: \"v0\"\r\nIf-Modified-Since: Sun, 01 Jun 2025 12:00:00 GMT\r\n")
+	assert.False(t, done)
+
+	// Test: If-Match compares strongly
+	done, _ = checkPreconditions(t, "PUT", "If-Match: \"v0\", \"v1\"\r\n")
+	assert.False(t, done)
+	done, res = checkPreconditions(t, "PUT", "If-Match: W/\"v1\"\r\n")
+	require.True(t, done)
+	assert.Equal(t, 412, res.StatusCode)
+
+	// Test: If-Unmodified-Since
+	done, res = checkPreconditions(t, "DELETE", "If-Unmodified-Since: Sat, 31 May 2025 12:00:00 GMT\r\n")
+	require.True(t, done)
+	assert.Equal(t, 412, res.StatusCode)
+	done, _ = checkPreconditions(t, "DELETE", "If-Unmodified-Since: Mon, 02 Jun 2025 12:00:00 GMT\r\n")
+	assert.False(t, done)
+
+	// Test: If-Match takes precedence over If-Unmodified-Since
+	done, _ = checkPreconditions(t, "PUT", "If-Match: \"v1\"\r\nIf-Unmodified-Since: Sat, 31 May 2025 12:00:00 GMT\r\n")
+	assert.False(t, done)
+}
+
+func TestServeContentConditional(t *testing.T) {
+	// Test: Matching entity tag skips the body
+	res, body := serveContent(t, "GET", "If-None-Match: \"v1\"\r\n")
+	assert.Equal(t, 304, res.StatusCode)
+	assert.Equal(t, "", body)
+
+	// Test: Failed If-Match wins over Range
+	res, _ = serveContent(t, "GET", "If-Match: \"v2\"\r\nRange: bytes=0-1\r\n")
+	assert.Equal(t, 412, res.StatusCode)
+}
+
+func checkPreconditions(t *testing.T, method, reqHeaders string) (bool, *http.Response) {
+	t.Helper()
+
+	req, err := request.RequestFromReader(strings.NewReader(method + " / HTTP/1.1\r\nHost: localhost\r\n" + reqHeaders + "\r\n"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	done := CheckPreconditions(NewWriter(&buf), req, "\"v1\"", modtime)
+	if !done {
+		assert.Equal(t, 0, buf.Len())
+		return false, nil
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(&buf), &http.Request{Method: method})
+	require.NoError(t, err)
+	return true, res
+}
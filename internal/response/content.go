@@ -0,0 +1,310 @@
+package response
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Number of bytes inspected when sniffing the content type of a body
+const sniffLen = 512
+
+// Requests asking for more ranges than this are answered with the full body
+const maxRanges = 32
+
+// Format of HTTP-date header values such as Last-Modified
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+var errNoOverlap = errors.New("requested range not satisfiable")
+
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// ServeContent writes content as the response body, honoring conditional
+// and Range request headers. The name is used to detect the content type by
+// extension when h has no Content-Type, falling back to sniffing the start
+// of the content. A non-zero modtime is sent as Last-Modified and, along
+// with an ETag in h, used to evaluate preconditions and If-Range. Any headers
+// in h are added to the response.
+func ServeContent(w *Writer, req *request.Request, name string, modtime time.Time, content io.ReadSeeker, h headers.Headers) {
+	etag, _ := h.Get("ETag")
+	if CheckPreconditions(w, req, etag, modtime) {
+		return
+	}
+
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		writeError(w, StatusInternalServerError)
+		return
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		writeError(w, StatusInternalServerError)
+		return
+	}
+
+	contentType, _ := h.Get("Content-Type")
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(name))
+	}
+	if contentType == "" {
+		buf := make([]byte, sniffLen)
+		n, err := io.ReadFull(content, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			writeError(w, StatusInternalServerError)
+			return
+		}
+		contentType = http.DetectContentType(buf[:n])
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			writeError(w, StatusInternalServerError)
+			return
+		}
+	}
+
+	headers := GetDefaultHeaders(0)
+	for key, value := range h {
+		headers.Replace(key, value)
+	}
+	headers.Replace("Content-Type", contentType)
+	headers.Replace("Accept-Ranges", "bytes")
+	if !modtime.IsZero() {
+		headers.Replace("Last-Modified", modtime.UTC().Format(TimeFormat))
+	}
+
+	ranges, err := requestedRanges(req, size, etag, modtime)
+	if err == errNoOverlap {
+		body := []byte(fmt.Sprintf("%d %s\n", StatusRequestedRangeNotSatisfiable, StatusText(StatusRequestedRangeNotSatisfiable)))
+		headers.Replace("Content-Length", strconv.Itoa(len(body)))
+		headers.Replace("Content-Type", "text/plain")
+		headers.Replace("Content-Range", fmt.Sprintf("bytes */%d", size))
+
+		w.WriteStatusLine(StatusRequestedRangeNotSatisfiable)
+		w.WriteHeaders(headers)
+		w.WriteBody(body)
+		return
+	}
+
+	switch len(ranges) {
+	case 0:
+		// Full content
+		headers.Replace("Content-Length", strconv.FormatInt(size, 10))
+
+		w.WriteStatusLine(StatusOK)
+		w.WriteHeaders(headers)
+		if req.RequestLine.Method == "HEAD" {
+			return
+		}
+		io.CopyN(w, content, size)
+	case 1:
+		// Single part with Content-Range in the response headers
+		ra := ranges[0]
+		if _, err := content.Seek(ra.start, io.SeekStart); err != nil {
+			writeError(w, StatusInternalServerError)
+			return
+		}
+		headers.Replace("Content-Length", strconv.FormatInt(ra.length, 10))
+		headers.Replace("Content-Range", ra.contentRange(size))
+
+		w.WriteStatusLine(StatusPartialContent)
+		w.WriteHeaders(headers)
+		if req.RequestLine.Method == "HEAD" {
+			return
+		}
+		io.CopyN(w, content, ra.length)
+	default:
+		// Multiple parts, each carrying its own Content-Type and Content-Range
+		boundary := randomBoundary()
+		partHeaders := make([]string, len(ranges))
+		length := int64(0)
+		for i, ra := range ranges {
+			partHeaders[i] = fmt.Sprintf("--%s\r\nContent-Type: %s\r\nContent-Range: %s\r\n\r\n", boundary, contentType, ra.contentRange(size))
+			length += int64(len(partHeaders[i])) + ra.length + int64(len("\r\n"))
+		}
+		closing := fmt.Sprintf("--%s--\r\n", boundary)
+		length += int64(len(closing))
+
+		headers.Replace("Content-Length", strconv.FormatInt(length, 10))
+		headers.Replace("Content-Type", "multipart/byteranges; boundary="+boundary)
+
+		w.WriteStatusLine(StatusPartialContent)
+		w.WriteHeaders(headers)
+		if req.RequestLine.Method == "HEAD" {
+			return
+		}
+		for i, ra := range ranges {
+			if _, err := content.Seek(ra.start, io.SeekStart); err != nil {
+				return
+			}
+			w.WriteBody([]byte(partHeaders[i]))
+			if _, err := io.CopyN(w, content, ra.length); err != nil {
+				return
+			}
+			w.WriteBody([]byte("\r\n"))
+		}
+		w.WriteBody([]byte(closing))
+	}
+}
+
+// Returns the ranges to serve, or none if the full content should be sent.
+// Range is only honored on GET and HEAD and is ignored when malformed or when
+// If-Range no longer matches the representation.
+func requestedRanges(req *request.Request, size int64, etag string, modtime time.Time) ([]byteRange, error) {
+	if req.RequestLine.Method != "GET" && req.RequestLine.Method != "HEAD" {
+		return nil, nil
+	}
+
+	value, ok := req.Headers.Get("Range")
+	if !ok || value == "" {
+		return nil, nil
+	}
+
+	if ifRange, ok := req.Headers.Get("If-Range"); ok {
+		if !ifRangeMatches(ifRange, etag, modtime) {
+			return nil, nil
+		}
+	}
+
+	ranges, err := parseRange(value, size)
+	if err != nil {
+		return nil, err
+	}
+	if len(ranges) > maxRanges || !reasonableRanges(ranges) {
+		return nil, nil
+	}
+
+	return ranges, nil
+}
+
+// Overlapping ranges, as in bytes=0-,0-,0-, would make the response bigger
+// than the full content. Like net/http the full content is sent instead.
+// Ranges that don't overlap can't add up to more than the content.
+func reasonableRanges(ranges []byteRange) bool {
+	sorted := slices.SortedFunc(slices.Values(ranges), func(a, b byteRange) int {
+		return cmp.Compare(a.start, b.start)
+	})
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].start < sorted[i-1].start+sorted[i-1].length {
+			return false
+		}
+	}
+	return true
+}
+
+// If-Range holds either an entity tag, which must match strongly, or the
+// Last-Modified date, which must match exactly.
+func ifRangeMatches(ifRange, etag string, modtime time.Time) bool {
+	ifRange = strings.TrimSpace(ifRange)
+	if strings.HasPrefix(ifRange, "\"") || strings.HasPrefix(ifRange, "W/") {
+		return strongMatch(ifRange, etag)
+	}
+
+	t, err := time.Parse(TimeFormat, ifRange)
+	if err != nil || modtime.IsZero() {
+		return false
+	}
+	return modtime.Truncate(time.Second).Equal(t)
+}
+
+// Parse a Range header value such as "bytes=0-499, -500" against the size of
+// the content. Malformed values yield no ranges and no error so the header
+// is ignored, while well-formed values that don't overlap the content yield
+// errNoOverlap.
+func parseRange(value string, size int64) ([]byteRange, error) {
+	spec, ok := strings.CutPrefix(value, "bytes=")
+	if !ok {
+		return nil, nil
+	}
+
+	var ranges []byteRange
+	specs := 0
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		specs++
+
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, nil
+		}
+		first = strings.TrimSpace(first)
+		last = strings.TrimSpace(last)
+
+		var ra byteRange
+		if first == "" {
+			// Suffix range: the final N bytes of the content
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			ra = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, nil
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, nil
+				}
+			}
+			if start >= size {
+				continue
+			}
+			if end >= size {
+				end = size - 1
+			}
+			ra = byteRange{start: start, length: end - start + 1}
+		}
+		ranges = append(ranges, ra)
+	}
+
+	if specs == 0 {
+		return nil, nil
+	}
+	if len(ranges) == 0 {
+		return nil, errNoOverlap
+	}
+
+	return ranges, nil
+}
+
+func randomBoundary() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func writeError(w *Writer, status StatusCode) {
+	body := []byte(fmt.Sprintf("%d %s\n", status, StatusText(status)))
+
+	w.WriteStatusLine(status)
+	w.WriteHeaders(GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
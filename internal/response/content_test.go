@@ -0,0 +1,142 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const content = "0123456789abcdefghij"
+
+var modtime = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestServeContentRanges(t *testing.T) {
+	// Test: No range serves the full content
+	res, body := serveContent(t, "GET", "")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "bytes", res.Header.Get("Accept-Ranges"))
+	assert.Equal(t, "text/plain; charset=utf-8", res.Header.Get("Content-Type"))
+	assert.Equal(t, "Sun, 01 Jun 2025 12:00:00 GMT", res.Header.Get("Last-Modified"))
+	assert.Equal(t, content, body)
+
+	// Test: Single range
+	res, body = serveContent(t, "GET", "Range: bytes=2-5\r\n")
+	assert.Equal(t, 206, res.StatusCode)
+	assert.Equal(t, "bytes 2-5/20", res.Header.Get("Content-Range"))
+	assert.Equal(t, "4", res.Header.Get("Content-Length"))
+	assert.Equal(t, "2345", body)
+
+	// Test: Open-ended and suffix ranges
+	res, body = serveContent(t, "GET", "Range: bytes=15-\r\n")
+	assert.Equal(t, 206, res.StatusCode)
+	assert.Equal(t, "fghij", body)
+	res, body = serveContent(t, "GET", "Range: bytes=-3\r\n")
+	assert.Equal(t, 206, res.StatusCode)
+	assert.Equal(t, "bytes 17-19/20", res.Header.Get("Content-Range"))
+	assert.Equal(t, "hij", body)
+
+	// Test: End past the content is clamped
+	res, body = serveContent(t, "GET", "Range: bytes=18-100\r\n")
+	assert.Equal(t, 206, res.StatusCode)
+	assert.Equal(t, "ij", body)
+
+	// Test: Multiple ranges produce multipart/byteranges
+	res, body = serveContent(t, "GET", "Range: bytes=0-1, 10-12\r\n")
+	assert.Equal(t, 206, res.StatusCode)
+	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+	mr := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	part, err := mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "bytes 0-1/20", part.Header.Get("Content-Range"))
+	data, _ := io.ReadAll(part)
+	assert.Equal(t, "01", string(data))
+	part, err = mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "bytes 10-12/20", part.Header.Get("Content-Range"))
+	data, _ = io.ReadAll(part)
+	assert.Equal(t, "abc", string(data))
+	_, err = mr.NextPart()
+	assert.Equal(t, io.EOF, err)
+
+	// Test: Overlapping ranges get the full content once, not once per range
+	res, body = serveContent(t, "GET", "Range: bytes="+strings.Repeat("0-,", 31)+"0-\r\n")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, content, body)
+	res, body = serveContent(t, "GET", "Range: bytes=10-12, 0-1, 12-15\r\n")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, content, body)
+
+	// Test: Range beyond the content is not satisfiable
+	res, _ = serveContent(t, "GET", "Range: bytes=20-30\r\n")
+	assert.Equal(t, 416, res.StatusCode)
+	assert.Equal(t, "bytes */20", res.Header.Get("Content-Range"))
+
+	// Test: Malformed range is ignored
+	res, body = serveContent(t, "GET", "Range: bytes=5-2\r\n")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, content, body)
+	res, _ = serveContent(t, "GET", "Range: items=0-1\r\n")
+	assert.Equal(t, 200, res.StatusCode)
+
+	// Test: Range is ignored for methods other than GET and HEAD
+	res, _ = serveContent(t, "POST", "Range: bytes=0-1\r\n")
+	assert.Equal(t, 200, res.StatusCode)
+
+	// Test: HEAD with a range has headers but no body
+	res, body = serveContent(t, "HEAD", "Range: bytes=0-1\r\n")
+	assert.Equal(t, 206, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get("Content-Length"))
+	assert.Equal(t, "", body)
+}
+
+func TestServeContentIfRange(t *testing.T) {
+	// Test: If-Range with the current Last-Modified date honors the range
+	res, body := serveContent(t, "GET", "Range: bytes=0-1\r\nIf-Range: Sun, 01 Jun 2025 12:00:00 GMT\r\n")
+	assert.Equal(t, 206, res.StatusCode)
+	assert.Equal(t, "01", body)
+
+	// Test: If-Range with an older date sends the full content
+	res, body = serveContent(t, "GET", "Range: bytes=0-1\r\nIf-Range: Sat, 31 May 2025 12:00:00 GMT\r\n")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, content, body)
+
+	// Test: If-Range with an entity tag is compared strongly
+	res, _ = serveContent(t, "GET", "Range: bytes=0-1\r\nIf-Range: \"v1\"\r\n")
+	assert.Equal(t, 206, res.StatusCode)
+	res, _ = serveContent(t, "GET", "Range: bytes=0-1\r\nIf-Range: \"v2\"\r\n")
+	assert.Equal(t, 200, res.StatusCode)
+	res, _ = serveContent(t, "GET", "Range: bytes=0-1\r\nIf-Range: W/\"v1\"\r\n")
+	assert.Equal(t, 200, res.StatusCode)
+}
+
+func serveContent(t *testing.T, method, reqHeaders string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := request.RequestFromReader(strings.NewReader(method + " /file.txt HTTP/1.1\r\nHost: localhost\r\n" + reqHeaders + "\r\n"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	h := headers.NewHeaders()
+	h.Set("ETag", "\"v1\"")
+	ServeContent(NewWriter(&buf), req, "file.txt", modtime, strings.NewReader(content), h)
+
+	res, err := http.ReadResponse(bufio.NewReader(&buf), &http.Request{Method: method})
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	return res, string(body)
+}
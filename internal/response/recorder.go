@@ -0,0 +1,40 @@
+package response
+
+import (
+	"httpfromtcp/internal/headers"
+	"io"
+)
+
+// Recorder is a Filter that records the status code and counts the body
+// bytes written, for access logs, metrics and tracing. It counts what the
+// filters added after it produce, so middleware using it must come before
+// any that changes the body, such as compression, to count what goes over
+// the wire. Read it from an OnDone hook: filters flush buffered output only
+// when the response completes.
+type Recorder struct {
+	StatusCode   StatusCode
+	BytesWritten int64
+}
+
+func (r *Recorder) Headers(statusCode StatusCode, _ headers.Headers) {
+	r.StatusCode = statusCode
+}
+
+func (r *Recorder) Body(w io.Writer) io.WriteCloser {
+	return &countingWriter{w: w, n: &r.BytesWritten}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.n += int64(n)
+	return n, err
+}
+
+func (cw *countingWriter) Close() error {
+	return nil
+}
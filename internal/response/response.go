@@ -5,6 +5,7 @@ import (
 	"httpfromtcp/internal/headers"
 	"io"
 	"strconv"
+	"strings"
 )
 
 func GetDefaultHeaders(contentLen int) headers.Headers {
@@ -17,14 +18,20 @@ func GetDefaultHeaders(contentLen int) headers.Headers {
 	return headers
 }
 
-func WriteHeaders(w io.Writer, headers headers.Headers) error {
-	var response []byte
-
+// Appends header lines and the blank line ending them. Fields holding
+// several values that can't be combined, such as Set-Cookie, are written once
+// per value.
+func appendHeaders(b []byte, headers headers.Headers) []byte {
 	for key, value := range headers {
-		response = append(response, []byte(fmt.Sprintf("%s: %s\r\n", key, value))...)
+		for line := range strings.SplitSeq(value, "\n") {
+			b = fmt.Appendf(b, "%s: %s\r\n", key, line)
+		}
 	}
+	return append(b, "\r\n"...)
+}
 
-	response = append(response, []byte("\r\n")...)
+func WriteHeaders(w io.Writer, headers headers.Headers) error {
+	response := appendHeaders(nil, headers)
 
 	_, err := w.Write(response)
 	if err != nil {
@@ -1,33 +1,76 @@
 package response
 
-import "io"
+import (
+	"fmt"
+	"io"
+)
 
 type StatusCode uint
 
 const (
-	StatusOK                  StatusCode = 200
-	StatusBadRequest                     = 400
-	StatusInternalServerError            = 500
+	StatusSwitchingProtocols           StatusCode = 101
+	StatusOK                           StatusCode = 200
+	StatusNoContent                    StatusCode = 204
+	StatusPartialContent               StatusCode = 206
+	StatusMovedPermanently             StatusCode = 301
+	StatusNotModified                  StatusCode = 304
+	StatusBadRequest                   StatusCode = 400
+	StatusUnauthorized                 StatusCode = 401
+	StatusForbidden                    StatusCode = 403
+	StatusNotFound                     StatusCode = 404
+	StatusMethodNotAllowed             StatusCode = 405
+	StatusPreconditionFailed           StatusCode = 412
+	StatusPayloadTooLarge              StatusCode = 413
+	StatusUnsupportedMediaType         StatusCode = 415
+	StatusRequestedRangeNotSatisfiable StatusCode = 416
+	StatusUpgradeRequired              StatusCode = 426
+	StatusTooManyRequests              StatusCode = 429
+	StatusInternalServerError          StatusCode = 500
+	StatusServiceUnavailable           StatusCode = 503
 )
 
-func WriteStatusLine(w io.Writer, statusCode StatusCode) error {
-	var response []byte
-
-	switch statusCode {
-	case StatusOK:
-		response = []byte("HTTP/1.1 200 OK\r\n")
-	case StatusBadRequest:
-		response = []byte("HTTP/1.1 400 Bad Request\r\n")
-	case StatusInternalServerError:
-		response = []byte("HTTP/1.1 500 Internal Server Error\r\n")
-	default:
-		response = []byte("HTTP/1.1 400 Bad Request\r\n")
-	}
+var statusText = map[StatusCode]string{
+	StatusSwitchingProtocols:           "Switching Protocols",
+	StatusOK:                           "OK",
+	StatusNoContent:                    "No Content",
+	StatusPartialContent:               "Partial Content",
+	StatusMovedPermanently:             "Moved Permanently",
+	StatusNotModified:                  "Not Modified",
+	StatusBadRequest:                   "Bad Request",
+	StatusUnauthorized:                 "Unauthorized",
+	StatusForbidden:                    "Forbidden",
+	StatusNotFound:                     "Not Found",
+	StatusMethodNotAllowed:             "Method Not Allowed",
+	StatusPreconditionFailed:           "Precondition Failed",
+	StatusPayloadTooLarge:              "Payload Too Large",
+	StatusUnsupportedMediaType:         "Unsupported Media Type",
+	StatusRequestedRangeNotSatisfiable: "Range Not Satisfiable",
+	StatusUpgradeRequired:              "Upgrade Required",
+	StatusTooManyRequests:              "Too Many Requests",
+	StatusInternalServerError:          "Internal Server Error",
+	StatusServiceUnavailable:           "Service Unavailable",
+}
+
+// StatusText returns the reason phrase for the status code, or an empty
+// string if the code is unknown.
+func StatusText(statusCode StatusCode) string {
+	return statusText[statusCode]
+}
 
-	_, err := w.Write(response)
+func WriteStatusLine(w io.Writer, statusCode StatusCode) error {
+	_, err := w.Write(statusLine(statusCode))
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func statusLine(statusCode StatusCode) []byte {
+	text, ok := statusText[statusCode]
+	if !ok {
+		return []byte("HTTP/1.1 400 Bad Request\r\n")
+	}
+
+	return []byte(fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, text))
+}
@@ -1,15 +1,35 @@
 package response
 
 import (
+	"errors"
 	"fmt"
 	"httpfromtcp/internal/headers"
 	"io"
+	"net"
 	"strings"
 )
 
+var ErrNotHijackable = errors.New("response writer is not backed by a connection")
+
+// Implemented by server connections that must stop using the connection
+// before a handler takes it over
+type hijackNotifier interface {
+	BeforeHijack()
+}
+
 type Writer struct {
 	writer      io.Writer
 	writerState writerState
+	statusCode  StatusCode
+	filters     []Filter
+	// Destination of body bytes, wrapped by any active filters
+	body io.Writer
+	// Filter writers to flush before the final chunk is written
+	closers []io.Closer
+	chunked bool
+	// Run once the response is complete
+	onDone  []func()
+	doneRan bool
 }
 
 type writerState int
@@ -18,8 +38,21 @@ const (
 	StatusLine writerState = iota
 	Headers
 	Body
+	Done
+	Hijacked
 )
 
+// A Filter transforms a response on its way to the connection. Middleware
+// adds filters to the writer before calling the next handler.
+type Filter interface {
+	// Headers is called with the status code and headers just before they
+	// are written and may modify the headers.
+	Headers(statusCode StatusCode, h headers.Headers)
+	// Body returns a writer that encodes the body into w, or nil to leave
+	// the body untouched. Closing it must flush any buffered output.
+	Body(w io.Writer) io.WriteCloser
+}
+
 func NewWriter(w io.Writer) *Writer {
 	return &Writer{
 		writer:      w,
@@ -27,29 +60,26 @@ func NewWriter(w io.Writer) *Writer {
 	}
 }
 
+// AddFilter registers a filter for the response. Filters added earlier sit
+// closer to the connection, so the filter of an outer middleware sees the
+// output of an inner one.
+func (w *Writer) AddFilter(f Filter) {
+	w.filters = append(w.filters, f)
+}
+
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 	if w.writerState != StatusLine {
 		return fmt.Errorf("cannot write status line in state %d", w.writerState)
 	}
 
-	var response []byte
-
-	switch statusCode {
-	case StatusOK:
-		response = []byte("HTTP/1.1 200 OK\r\n")
-	case StatusBadRequest:
-		response = []byte("HTTP/1.1 400 Bad Request\r\n")
-	case StatusInternalServerError:
-		response = []byte("HTTP/1.1 500 Internal Server Error\r\n")
-	default:
-		response = []byte("HTTP/1.1 400 Bad Request\r\n")
-	}
+	response := statusLine(statusCode)
 
 	_, err := w.writer.Write(response)
 	if err != nil {
 		return err
 	}
 
+	w.statusCode = statusCode
 	w.writerState = Headers
 	return nil
 }
@@ -59,19 +89,31 @@ func (w *Writer) WriteHeaders(headers headers.Headers) error {
 		return fmt.Errorf("cannot write headers in state %d", w.writerState)
 	}
 
-	var response []byte
-
-	for key, value := range headers {
-		response = append(response, []byte(fmt.Sprintf("%s: %s\r\n", key, value))...)
+	for i := len(w.filters) - 1; i >= 0; i-- {
+		w.filters[i].Headers(w.statusCode, headers)
 	}
 
-	response = append(response, []byte("\r\n")...)
+	response := appendHeaders(nil, headers)
 
 	_, err := w.writer.Write(response)
 	if err != nil {
 		return err
 	}
 
+	// The final headers decide how the body is framed
+	te, _ := headers.Get("Transfer-Encoding")
+	w.chunked = strings.Contains(strings.ToLower(te), "chunked")
+	w.body = w.writer
+	if w.chunked {
+		w.body = &chunkedWriter{w: w.writer}
+	}
+	for _, f := range w.filters {
+		if fw := f.Body(w.body); fw != nil {
+			w.body = fw
+			w.closers = append(w.closers, fw)
+		}
+	}
+
 	w.writerState = Body
 	return nil
 }
@@ -81,7 +123,12 @@ func (w *Writer) WriteBody(p []byte) (int, error) {
 		return 0, fmt.Errorf("cannot write body in state %d", w.writerState)
 	}
 
-	return w.writer.Write(p)
+	return w.body.Write(p)
+}
+
+// Write implements io.Writer so a body can be streamed with io.Copy.
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.WriteBody(p)
 }
 
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
@@ -89,22 +136,36 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 		return 0, fmt.Errorf("cannot write chunked body in state %d", w.writerState)
 	}
 
-	// Write length of data in hex
-	w.writer.Write([]byte(fmt.Sprintf("%04X\r\n", len(p))))
-	// Append carriage return to data and write
-	p = append(p, []byte("\r\n")...)
-	w.writer.Write(p)
-
-	return len(p), nil
+	return w.body.Write(p)
 }
 
 func (w *Writer) WriteChunkedBodyDone() (int, error) {
-	w.writer.Write([]byte("0\r\n\r\n"))
+	if w.writerState != Body {
+		return 0, fmt.Errorf("cannot finish chunked body in state %d", w.writerState)
+	}
 
-	return 0, nil
+	defer w.runOnDone()
+	err := w.closeFilters()
+	w.writerState = Done
+	if err != nil {
+		return 0, err
+	}
+
+	return w.writer.Write([]byte("0\r\n\r\n"))
 }
 
 func (w *Writer) WriteTrailers(h headers.Headers) error {
+	if w.writerState != Body {
+		return fmt.Errorf("cannot write trailers in state %d", w.writerState)
+	}
+
+	defer w.runOnDone()
+	err := w.closeFilters()
+	w.writerState = Done
+	if err != nil {
+		return err
+	}
+
 	w.writer.Write([]byte("0\r\n"))
 	trailers, ok := h.Get("Trailer")
 	if !ok {
@@ -122,3 +183,106 @@ func (w *Writer) WriteTrailers(h headers.Headers) error {
 
 	return nil
 }
+
+// OnDone registers f to run once the response is complete, when Finish,
+// WriteChunkedBodyDone or WriteTrailers ends it or the connection is
+// hijacked. Middleware that measures the response uses it rather than
+// finishing the response itself, which would cut off the filters of outer
+// middleware.
+func (w *Writer) OnDone(f func()) {
+	w.onDone = append(w.onDone, f)
+}
+
+func (w *Writer) runOnDone() {
+	if w.doneRan {
+		return
+	}
+	w.doneRan = true
+	for _, f := range w.onDone {
+		f()
+	}
+}
+
+// Finish completes the response once the handler has returned. It flushes
+// any filters and ends a chunked body the handler left open, which happens
+// when a filter switched the response to chunked framing.
+func (w *Writer) Finish() error {
+	if w.writerState != Body {
+		w.runOnDone()
+		return nil
+	}
+
+	if w.chunked {
+		_, err := w.WriteChunkedBodyDone()
+		return err
+	}
+
+	w.writerState = Done
+	err := w.closeFilters()
+	w.runOnDone()
+	return err
+}
+
+// Hijack takes over the underlying connection, for protocols such as
+// WebSocket that outlive the response. Once hijacked the writer can't be
+// used and the server no longer closes the connection, so the caller is
+// responsible for writing any response and closing it.
+func (w *Writer) Hijack() (net.Conn, error) {
+	if w.writerState == Hijacked {
+		return nil, fmt.Errorf("connection already hijacked")
+	}
+
+	conn, ok := w.writer.(net.Conn)
+	if !ok {
+		return nil, ErrNotHijackable
+	}
+
+	if n, ok := conn.(hijackNotifier); ok {
+		n.BeforeHijack()
+	}
+
+	w.writerState = Hijacked
+	w.runOnDone()
+	return conn, nil
+}
+
+// Hijacked reports whether the connection was taken over by Hijack.
+func (w *Writer) Hijacked() bool {
+	return w.writerState == Hijacked
+}
+
+// Close the filter writers from the handler side outward so each flushes
+// into the next
+func (w *Writer) closeFilters() error {
+	var firstErr error
+	for i := len(w.closers) - 1; i >= 0; i-- {
+		if err := w.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	w.closers = nil
+	return firstErr
+}
+
+// Frames each write as a chunk of the chunked transfer coding
+type chunkedWriter struct {
+	w io.Writer
+}
+
+func (cw *chunkedWriter) Write(p []byte) (int, error) {
+	// An empty chunk would end the body
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// Write length of data in hex followed by the data and a CRLF
+	chunk := make([]byte, 0, len(p)+8)
+	chunk = append(chunk, []byte(fmt.Sprintf("%04X\r\n", len(p)))...)
+	chunk = append(chunk, p...)
+	chunk = append(chunk, []byte("\r\n")...)
+	if _, err := cw.w.Write(chunk); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,64 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHeadersSetCookie(t *testing.T) {
+	// Test: Each Set-Cookie value is written as its own field
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	h := GetDefaultHeaders(0)
+	h.Set("Set-Cookie", "a=1; Path=/")
+	h.Set("Set-Cookie", "b=2; Expires=Tue, 01 Jan 2030 00:00:00 GMT")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+
+	assert.Equal(t, 2, bytes.Count(buf.Bytes(), []byte("Set-Cookie: ")))
+
+	res, err := http.ReadResponse(bufio.NewReader(&buf), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a=1; Path=/", "b=2; Expires=Tue, 01 Jan 2030 00:00:00 GMT"}, res.Header.Values("Set-Cookie"))
+}
+
+func TestOnDone(t *testing.T) {
+	// Test: Hooks run once, when Finish completes the response
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	calls := 0
+	w.OnDone(func() { calls++ })
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.Equal(t, 0, calls)
+	require.NoError(t, w.Finish())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, 1, calls)
+
+	// Test: Ending a chunked body runs them too, and Finish doesn't again
+	w = NewWriter(&buf)
+	calls = 0
+	w.OnDone(func() { calls++ })
+	w.WriteStatusLine(StatusOK)
+	h := GetDefaultHeaders(0)
+	h.Remove("Content-Length")
+	h.Set("Transfer-Encoding", "chunked")
+	w.WriteHeaders(h)
+	_, err := w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	w.Finish()
+	assert.Equal(t, 1, calls)
+
+	// Test: A response that was never started still runs them on Finish
+	w = NewWriter(&buf)
+	calls = 0
+	w.OnDone(func() { calls++ })
+	w.Finish()
+	assert.Equal(t, 1, calls)
+}
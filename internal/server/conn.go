@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var ErrClientDisconnected = errors.New("client disconnected")
+
+// A connection being served. It cancels the request context when the client
+// goes away or a write to it fails.
+type conn struct {
+	net.Conn
+	cancel context.CancelCauseFunc
+
+	watchOnce sync.Once
+	stopOnce  sync.Once
+	watchDone chan struct{}
+}
+
+func newConn(c net.Conn, cancel context.CancelCauseFunc) *conn {
+	return &conn{
+		Conn:      c,
+		cancel:    cancel,
+		watchDone: make(chan struct{}),
+	}
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if err != nil {
+		c.cancel(err)
+	}
+	return n, err
+}
+
+// Read from the connection in the background while the handler runs so a
+// closed peer is noticed even when the handler isn't writing. The request
+// has been read in full, so anything arriving now is discarded.
+func (c *conn) watch() {
+	c.watchOnce.Do(func() {
+		go func() {
+			defer close(c.watchDone)
+			buf := make([]byte, 512)
+			for {
+				if _, err := c.Conn.Read(buf); err != nil {
+					var netErr net.Error
+					if errors.As(err, &netErr) && netErr.Timeout() {
+						return
+					}
+					c.cancel(ErrClientDisconnected)
+					return
+				}
+			}
+		}()
+	})
+}
+
+// Stop the background read by expiring the read deadline and wait for it to
+// finish, leaving the connection free for the caller to read from
+func (c *conn) stopWatching() {
+	c.stopOnce.Do(func() {
+		// Make sure a watch that hasn't started never will
+		c.watchOnce.Do(func() { close(c.watchDone) })
+
+		select {
+		case <-c.watchDone:
+			return
+		default:
+		}
+		c.Conn.SetReadDeadline(time.Now())
+		<-c.watchDone
+		c.Conn.SetReadDeadline(time.Time{})
+	})
+}
+
+// BeforeHijack hands the connection over to the handler undisturbed.
+func (c *conn) BeforeHijack() {
+	c.stopWatching()
+}
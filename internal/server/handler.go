@@ -1,8 +1,10 @@
 package server
 
 import (
+	"context"
 	"httpfromtcp/internal/request"
 	"httpfromtcp/internal/response"
+	"time"
 )
 
 type HandlerError struct {
@@ -11,3 +13,28 @@ type HandlerError struct {
 }
 
 type Handler func(w *response.Writer, req *request.Request)
+
+// Middleware wraps a handler to add behavior before or after it runs.
+type Middleware func(next Handler) Handler
+
+// Chain wraps the handler with the middleware so the first middleware is the
+// outermost and sees the request first.
+func Chain(handler Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// Timeout cancels the request context once the duration has passed, for
+// routes that should give up on slow work. Handlers must watch the context
+// and stop on their own.
+func Timeout(d time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			ctx, cancel := context.WithTimeout(req.Context(), d)
+			defer cancel()
+			next(w, req.WithContext(ctx))
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"errors"
+	"httpfromtcp/internal/response"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// Backoff between failed accepts, doubling up to the maximum
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+
+	// How long a rejected connection is given to receive its 503
+	rejectTimeout = time.Second
+	// How much of a rejected client's request is read before closing
+	maxRejectDrain = 64 << 10
+	// Rejections answered at once. Connections over it are closed without
+	// a response so a flood doesn't cost a goroutine each.
+	maxRejecting = 64
+)
+
+var errTooManyConns = errors.New("too many connections")
+
+// Take a slot for conn and start tracking it, or turn it away. When the
+// server is full this waits for a slot, leaving later connections in the
+// listener's backlog, unless it rejects instead.
+func (s *Server) admit(conn net.Conn) bool {
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			if s.rejectWhenFull {
+				s.rejectAsync(conn)
+				return false
+			}
+			select {
+			case s.slots <- struct{}{}:
+			case <-s.ctx.Done():
+				conn.Close()
+				return false
+			}
+		}
+	}
+
+	err := s.track(conn)
+	if err == nil {
+		return true
+	}
+	s.releaseSlot()
+	if errors.Is(err, errTooManyConns) {
+		s.rejectAsync(conn)
+	} else {
+		conn.Close()
+	}
+	return false
+}
+
+func (s *Server) releaseSlot() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// Reject conn in the background, or just close it when enough rejections
+// are in progress already
+func (s *Server) rejectAsync(conn net.Conn) {
+	select {
+	case s.rejecting <- struct{}{}:
+		go func() {
+			defer func() { <-s.rejecting }()
+			s.reject(conn)
+		}()
+	default:
+		conn.Close()
+	}
+}
+
+// Answer a connection the server has no room for with 503 Service
+// Unavailable and close it
+func (s *Server) reject(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(rejectTimeout))
+
+	headers := response.GetDefaultHeaders(0)
+	headers.Set("Retry-After", strconv.Itoa(int(math.Ceil(s.retryAfter.Seconds()))))
+	if err := response.WriteStatusLine(conn, response.StatusServiceUnavailable); err != nil {
+		return
+	}
+	if err := response.WriteHeaders(conn, headers); err != nil {
+		return
+	}
+
+	// Closing with the request unread would reset the connection and could
+	// discard the response before the client reads it
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		io.Copy(io.Discard, io.LimitReader(conn, maxRejectDrain))
+	}
+}
+
+// The IP address of a TCP client, or an empty string for other networks
+func clientIP(conn net.Conn) string {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
+
+func nextAcceptDelay(delay time.Duration) time.Duration {
+	if delay == 0 {
+		return minAcceptDelay
+	}
+	return min(delay*2, maxAcceptDelay)
+}
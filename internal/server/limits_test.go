@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxConns(t *testing.T) {
+	// Test: Connection over the limit is rejected with 503 and Retry-After
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	s := serve(t, blockingHandler(started, release), MaxConns(1), RejectWhenFull(), RetryAfter(1500*time.Millisecond))
+	first := dial(t, s)
+	first.Write([]byte(getRequest))
+	<-started
+	res := get(t, s)
+	assert.Equal(t, 503, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get("Retry-After"))
+
+	// Test: With too many rejections in progress the connection is closed
+	// without an answer
+	for range maxRejecting {
+		s.rejecting <- struct{}{}
+	}
+	dropped := dial(t, s)
+	dropped.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := dropped.Read(make([]byte, 1))
+	assert.Equal(t, 0, n)
+	assert.ErrorIs(t, err, io.EOF)
+	for range maxRejecting {
+		<-s.rejecting
+	}
+
+	// Test: Slot is free again once the connection finishes
+	close(release)
+	readResponse(t, first)
+	assert.Equal(t, 200, get(t, s).StatusCode)
+
+	// Test: Without RejectWhenFull the connection waits for a slot
+	release = make(chan struct{})
+	started = make(chan struct{}, 2)
+	s = serve(t, blockingHandler(started, release), MaxConns(1))
+	first = dial(t, s)
+	first.Write([]byte(getRequest))
+	<-started
+	second := dial(t, s)
+	second.Write([]byte(getRequest))
+	select {
+	case <-started:
+		t.Fatal("second connection served while the server was full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	assert.Equal(t, 200, readResponse(t, first).StatusCode)
+	assert.Equal(t, 200, readResponse(t, second).StatusCode)
+}
+
+func TestReadTimeout(t *testing.T) {
+	// Test: An idle connection is dropped without an answer
+	s := serve(t, okHandler, MaxConns(1), RejectWhenFull(), ReadTimeout(50*time.Millisecond))
+	idle := dial(t, s)
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := idle.Read(make([]byte, 1))
+	assert.Equal(t, 0, n)
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Its slot is free for the next client
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.conns) == 0
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 200, get(t, s).StatusCode)
+
+	// Test: A slow request is dropped too
+	slow := dial(t, s)
+	slow.Write([]byte("GET / HTTP/1.1\r\n"))
+	_, err = slow.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestMaxConnsPerIP(t *testing.T) {
+	// Test: Second connection from the same IP is rejected
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	s := serve(t, blockingHandler(started, release), MaxConnsPerIP(1))
+	first := dial(t, s)
+	first.Write([]byte(getRequest))
+	<-started
+	res := get(t, s)
+	assert.Equal(t, 503, res.StatusCode)
+	assert.Equal(t, "1", res.Header.Get("Retry-After"))
+
+	// Test: Count drops when the connection closes
+	close(release)
+	readResponse(t, first)
+	assert.Equal(t, 200, get(t, s).StatusCode)
+}
+
+func TestMaxBodySize(t *testing.T) {
+	s := serve(t, okHandler, MaxBodySize(10))
+	post := func(body string) *http.Response {
+		conn := dial(t, s)
+		conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: " +
+			strconv.Itoa(len(body)) + "\r\n\r\n" + body))
+		return readResponse(t, conn)
+	}
+
+	// Test: Bodies over the limit are refused with 413
+	assert.Equal(t, 413, post("eleven byte").StatusCode)
+
+	// Test: Bodies within it are served
+	assert.Equal(t, 200, post("ten bytes!").StatusCode)
+}
+
+func TestAcceptBackoff(t *testing.T) {
+	// Test: Failed accepts are retried with growing delays
+	listener := &failingListener{Listener: listen(t), failures: 3}
+	s := Serve(listener, okHandler)
+	t.Cleanup(func() { s.Close() })
+	assert.Equal(t, 200, get(t, s).StatusCode)
+
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	require.GreaterOrEqual(t, len(listener.attempts), 4)
+	for i, want := range []time.Duration{minAcceptDelay, 2 * minAcceptDelay, 4 * minAcceptDelay} {
+		assert.GreaterOrEqual(t, listener.attempts[i+1].Sub(listener.attempts[i]), want)
+	}
+}
+
+// Handler that reports it started and waits for release before answering
+func blockingHandler(started chan<- struct{}, release <-chan struct{}) Handler {
+	return func(w *response.Writer, _ *request.Request) {
+		started <- struct{}{}
+		<-release
+		writeOK(w)
+	}
+}
+
+func readResponse(t *testing.T, conn net.Conn) *http.Response {
+	t.Helper()
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	return res
+}
+
+// Fails the first accepts like a process out of file descriptors
+type failingListener struct {
+	net.Listener
+	mu       sync.Mutex
+	failures int
+	attempts []time.Time
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	l.attempts = append(l.attempts, time.Now())
+	fail := len(l.attempts) <= l.failures
+	l.mu.Unlock()
+
+	if fail {
+		return nil, errors.New("accept: too many open files")
+	}
+	return l.Listener.Accept()
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// The first file descriptor passed by systemd socket activation
+const listenFDsStart = 3
+
+// ListenUnix listens on a Unix domain socket at path with its file mode set
+// to mode. A socket file left behind by a process that exited without
+// cleaning up is removed, but one that still accepts connections is an
+// error. The socket file is removed when the listener is closed.
+func ListenUnix(path string, mode fs.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("server: %s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("server: %s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
+
+// ListenReusePort listens on the TCP address addr with SO_REUSEPORT set, so
+// several processes can bind the same port and the kernel spreads new
+// connections between them.
+func ListenReusePort(addr string) (net.Listener, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				sockErr = setReusePort(fd)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// SystemdListeners returns the listening sockets passed to the process by
+// systemd socket activation, in the order they're configured in the socket
+// unit, or none when the process wasn't socket activated. The activation
+// environment variables are unset so child processes don't inherit them.
+func SystemdListeners() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	return listenersFromEnv(os.Getenv, listenFDsStart)
+}
+
+func listenersFromEnv(getenv func(string) string, firstFD int) ([]net.Listener, error) {
+	// The variables are meant for the process systemd started, not for any
+	// child that inherited them
+	pid, err := strconv.Atoi(getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+	names := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+
+	return fileListeners(firstFD, count, names)
+}
+
+// Listeners for count inherited descriptors starting at firstFD, named by
+// names where given
+func fileListeners(firstFD, count int, names []string) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, count)
+	for i := range count {
+		fd := firstFD + i
+
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		// FileListener dups the descriptor, so the original is closed
+		file.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("server: inherited fd %d (%s): %w", fd, name, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServe(t *testing.T) {
+	// Test: Serve on a listener bound to a specific interface
+	s := Serve(listen(t), okHandler)
+	t.Cleanup(func() { s.Close() })
+	assert.Equal(t, 200, get(t, s).StatusCode)
+
+	// Test: ListenAndServe on an IPv6 address
+	s, err := ListenAndServe("[::1]:0", okHandler)
+	if err != nil {
+		t.Log("IPv6 loopback unavailable:", err)
+	} else {
+		t.Cleanup(func() { s.Close() })
+		assert.Equal(t, 200, get(t, s).StatusCode)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "http.sock")
+
+	// Test: Socket file gets the requested mode
+	listener, err := ListenUnix(path, 0o660)
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o660), info.Mode().Perm())
+
+	// Test: Requests are served over the socket
+	s := Serve(listener, okHandler)
+	assert.Equal(t, 200, get(t, s).StatusCode)
+
+	// Test: Socket in use by a live server is left alone
+	_, err = ListenUnix(path, 0o660)
+	assert.Error(t, err)
+
+	// Test: Socket file is removed on close
+	s.Close()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	// Test: Stale socket file from a crashed process is replaced
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	listener, err = ListenUnix(path, 0o600)
+	require.NoError(t, err)
+	listener.Close()
+
+	// Test: Regular file at the path is not removed
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0o600))
+	_, err = ListenUnix(path, 0o600)
+	assert.Error(t, err)
+}
@@ -0,0 +1,68 @@
+//go:build unix
+
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenReusePort(t *testing.T) {
+	// Test: Two listeners share one port
+	first, err := ListenReusePort("127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { first.Close() })
+	second, err := ListenReusePort(first.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { second.Close() })
+
+	// Test: Without SO_REUSEPORT the port is taken
+	_, err = net.Listen("tcp", first.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestSystemdListeners(t *testing.T) {
+	inherited := listen(t)
+	file, err := inherited.(*net.TCPListener).File()
+	require.NoError(t, err)
+	// A bare descriptor like the ones systemd passes, not owned by an os.File
+	fd, err := syscall.Dup(int(file.Fd()))
+	require.NoError(t, err)
+	file.Close()
+
+	env := map[string]string{
+		"LISTEN_PID":     strconv.Itoa(os.Getpid()),
+		"LISTEN_FDS":     "1",
+		"LISTEN_FDNAMES": "http",
+	}
+
+	// Test: Variables meant for another process are ignored
+	listeners, err := listenersFromEnv(func(key string) string {
+		if key == "LISTEN_PID" {
+			return "1"
+		}
+		return env[key]
+	}, fd)
+	require.NoError(t, err)
+	assert.Empty(t, listeners)
+
+	// Test: Inherited socket is served
+	listeners, err = listenersFromEnv(func(key string) string { return env[key] }, fd)
+	require.NoError(t, err)
+	require.Len(t, listeners, 1)
+	assert.Equal(t, inherited.Addr().String(), listeners[0].Addr().String())
+	s := Serve(listeners[0], okHandler)
+	t.Cleanup(func() { s.Close() })
+	assert.Equal(t, 200, get(t, s).StatusCode)
+
+	// Test: Not socket activated
+	listeners, err = SystemdListeners()
+	require.NoError(t, err)
+	assert.Empty(t, listeners)
+}
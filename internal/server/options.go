@@ -0,0 +1,97 @@
+package server
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Retry-After sent with 503 responses unless RetryAfter is given
+const DefaultRetryAfter = time.Second
+
+// Largest request body read unless MaxBodySize is given
+const DefaultMaxBodySize = 32 << 20
+
+// Time allowed for a TLS handshake unless HandshakeTimeout is given
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// Time allowed for reading a request unless ReadTimeout is given
+const DefaultReadTimeout = 30 * time.Second
+
+// An Option configures a Server when it starts serving.
+type Option func(*Server)
+
+// MaxConns limits how many connections are served at once. When the limit is
+// reached the server stops accepting, so new connections wait in the
+// listener's backlog until one finishes, unless RejectWhenFull is given.
+func MaxConns(n int) Option {
+	return func(s *Server) {
+		s.slots = make(chan struct{}, n)
+	}
+}
+
+// RejectWhenFull answers connections over the MaxConns limit with 503
+// Service Unavailable and a Retry-After header instead of queueing them.
+func RejectWhenFull() Option {
+	return func(s *Server) {
+		s.rejectWhenFull = true
+	}
+}
+
+// MaxConnsPerIP limits how many connections a single client IP address can
+// have open at once. Connections over the limit are answered with 503 Service
+// Unavailable and a Retry-After header. Unix socket clients aren't limited.
+func MaxConnsPerIP(n int) Option {
+	return func(s *Server) {
+		s.maxConnsPerIP = n
+	}
+}
+
+// RetryAfter sets how long rejected clients are told to wait before trying
+// again.
+func RetryAfter(d time.Duration) Option {
+	return func(s *Server) {
+		s.retryAfter = d
+	}
+}
+
+// MaxBodySize limits request bodies, which are read into memory before the
+// handler runs. Requests with a larger Content-Length are answered with 413
+// Payload Too Large without reading the body. Zero or less allows any size.
+func MaxBodySize(n int) Option {
+	return func(s *Server) {
+		s.maxBodySize = max(n, 0)
+	}
+}
+
+// HandshakeTimeout limits how long a TLS client has to complete the
+// handshake. Zero or less waits forever.
+func HandshakeTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.handshakeTimeout = d
+	}
+}
+
+// ReadTimeout limits how long a client has to send its request line, headers
+// and body, which are all read before the handler runs. Connections that
+// don't are closed so idle or slow clients can't hold on to a MaxConns slot.
+// Zero or less waits forever.
+func ReadTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readTimeout = d
+	}
+}
+
+// Logger sets where the server reports errors such as failed accepts,
+// slog.Default() otherwise.
+func Logger(l *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+// Observe reports connection events to o, for metrics.
+func Observe(o Observer) Option {
+	return func(s *Server) {
+		s.observer = o
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package server
+
+import "errors"
+
+func setReusePort(fd uintptr) error {
+	return errors.New("server: SO_REUSEPORT is not supported on this platform")
+}
@@ -1,70 +1,289 @@
 package server
 
 import (
-	"fmt"
+	"context"
+	"crypto/tls"
+	"errors"
 	"httpfromtcp/internal/request"
 	"httpfromtcp/internal/response"
+	"log/slog"
 	"net"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
+var ErrServerClosed = errors.New("server closed")
+
+// Observer is told about connections as the server handles them. Its methods
+// are called concurrently.
+type Observer interface {
+	// ConnOpened is called when a connection is accepted for serving
+	ConnOpened(conn net.Conn)
+	// ConnClosed is called once the server is done with the connection,
+	// including when the handler hijacked it
+	ConnClosed(conn net.Conn)
+	// ParseError is called when the request on a connection can't be parsed
+	ParseError(conn net.Conn, err error)
+}
+
+type noopObserver struct{}
+
+func (noopObserver) ConnOpened(net.Conn)        {}
+func (noopObserver) ConnClosed(net.Conn)        {}
+func (noopObserver) ParseError(net.Conn, error) {}
+
 type Server struct {
 	listener net.Listener
 	closed   atomic.Bool
 	handler  Handler
+	// Parent of every request context, cancelled when the server closes
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	// Connections being served with their client IPs, so Shutdown can wait
+	// for them to finish and per-IP limits can be enforced
+	mu     sync.Mutex
+	conns  map[net.Conn]string
+	perIP  map[string]int
+	active sync.WaitGroup
+
+	// Connection limits, set through options
+	slots          chan struct{}
+	rejectWhenFull bool
+	maxConnsPerIP  int
+	retryAfter     time.Duration
+	maxBodySize    int
+	// Rejections in progress, bounded by maxRejecting
+	rejecting chan struct{}
+
+	// Deadlines for the work done before the handler runs
+	handshakeTimeout time.Duration
+	readTimeout      time.Duration
+
+	logger   *slog.Logger
+	observer Observer
+}
+
+// Serve accepts connections on listener and serves each with handler until
+// the server is closed.
+func Serve(listener net.Listener, handler Handler, opts ...Option) *Server {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	server := &Server{
+		listener:    listener,
+		handler:     handler,
+		ctx:         ctx,
+		cancel:      cancel,
+		conns:       map[net.Conn]string{},
+		perIP:       map[string]int{},
+		retryAfter:  DefaultRetryAfter,
+		maxBodySize: DefaultMaxBodySize,
+		logger:      slog.Default(),
+		observer:    noopObserver{},
+		rejecting:   make(chan struct{}, maxRejecting),
+
+		handshakeTimeout: DefaultHandshakeTimeout,
+		readTimeout:      DefaultReadTimeout,
+	}
+	for _, opt := range opts {
+		opt(server)
+	}
+	go server.listen()
+
+	return server
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+// ListenAndServe listens on the TCP address addr, such as ":42069",
+// "127.0.0.1:8080" or "[::1]:8080", and serves connections with handler.
+func ListenAndServe(addr string, handler Handler, opts ...Option) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
 	if err != nil {
-		fmt.Printf("Error opening TCP listener on port %d: %v\n", port, err)
 		return nil, err
 	}
 
-	server := &Server{
-		listener: listener,
-		handler:  handler,
-	}
-	go server.listen()
+	return Serve(listener, handler, opts...), nil
+}
 
-	return server, nil
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
 }
 
+// Close stops accepting connections and cancels the context of every request
+// in flight without waiting for the handlers to return.
 func (s *Server) Close() error {
-	s.closed.Store(true)
+	s.stopAccepting()
+	s.cancel(ErrServerClosed)
 	if s.listener != nil {
 		return s.listener.Close()
 	}
 	return nil
 }
 
+// Shutdown stops accepting connections and waits for the requests in flight
+// to finish. If ctx ends first, the remaining connections are closed, their
+// request contexts are cancelled and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopAccepting()
+	err := s.listener.Close()
+
+	done := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.cancel(ErrServerClosed)
+		return err
+	case <-ctx.Done():
+		s.cancel(ErrServerClosed)
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Once this returns no new connection is tracked, so waiting on active can't
+// race with a connection that was just accepted
+func (s *Server) stopAccepting() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed.Store(true)
+}
+
+// Record a connection as active. It fails if the server is closing or the
+// client IP has reached its connection limit.
+func (s *Server) track(conn net.Conn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed.Load() {
+		return ErrServerClosed
+	}
+	ip := clientIP(conn)
+	if ip != "" && s.maxConnsPerIP > 0 && s.perIP[ip] >= s.maxConnsPerIP {
+		return errTooManyConns
+	}
+
+	s.conns[conn] = ip
+	if ip != "" {
+		s.perIP[ip]++
+	}
+	s.active.Add(1)
+	s.observer.ConnOpened(conn)
+	return nil
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ip := s.conns[conn]; ip != "" {
+		s.perIP[ip]--
+		if s.perIP[ip] == 0 {
+			delete(s.perIP, ip)
+		}
+	}
+	delete(s.conns, conn)
+	s.releaseSlot()
+	s.observer.ConnClosed(conn)
+	s.active.Done()
+}
+
 func (s *Server) listen() {
+	var delay time.Duration
 	for {
 		conn, err := s.listener.Accept()
 		if err != nil {
-			if s.closed.Load() {
+			if s.closed.Load() || errors.Is(err, net.ErrClosed) {
 				return
 			}
 
-			fmt.Printf("Error accepting connection: %v\n", err)
+			// Errors such as running out of file descriptors usually clear
+			// up once connections close, so back off rather than spin
+			delay = nextAcceptDelay(delay)
+			s.logger.Error("accepting connection", "error", err, "retry_in", delay)
+			select {
+			case <-time.After(delay):
+			case <-s.ctx.Done():
+				return
+			}
 			continue
 		}
+		delay = 0
 
-		go s.handle(conn)
+		if s.admit(conn) {
+			go s.handle(conn)
+		}
 	}
 }
 
-func (s *Server) handle(conn net.Conn) {
-	defer conn.Close()
+func (s *Server) handle(netConn net.Conn) {
+	defer s.untrack(netConn)
+	ctx, cancel := context.WithCancelCause(s.ctx)
+	defer cancel(context.Canceled)
+
+	// Finish the handshake up front so a failed one isn't answered with a
+	// plaintext 400
+	var tlsState *tls.ConnectionState
+	if tlsConn, ok := netConn.(*tls.Conn); ok {
+		netConn.SetDeadline(deadline(s.handshakeTimeout))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			netConn.Close()
+			return
+		}
+		netConn.SetDeadline(time.Time{})
+		state := tlsConn.ConnectionState()
+		tlsState = &state
+	}
+	conn := newConn(netConn, cancel)
 
-	r, err := request.RequestFromReader(conn)
+	netConn.SetReadDeadline(deadline(s.readTimeout))
+	r, err := request.RequestFromReaderLimit(conn, s.maxBodySize)
+	// A client that went quiet gets no answer, it may not be reading either
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		conn.Close()
+		return
+	}
 	if err != nil {
-		response.WriteStatusLine(conn, response.StatusBadRequest)
+		s.observer.ParseError(netConn, err)
+		status := response.StatusBadRequest
+		if errors.Is(err, request.ErrBodyTooLarge) {
+			status = response.StatusPayloadTooLarge
+		}
+		response.WriteStatusLine(conn, status)
 		response.WriteHeaders(conn, response.GetDefaultHeaders(0))
+		conn.Close()
 		return
 	}
 
+	netConn.SetReadDeadline(time.Time{})
+	r.RemoteAddr = netConn.RemoteAddr().String()
+	r.TLS = tlsState
+
+	conn.watch()
 	writer := response.NewWriter(conn)
-	s.handler(writer, r)
-	return
+	s.handler(writer, r.WithContext(ctx))
+
+	// A hijacked connection belongs to the handler now
+	if writer.Hijacked() {
+		return
+	}
+	writer.Finish()
+	conn.stopWatching()
+	conn.Close()
+}
+
+// The deadline for something that must finish within timeout, none when
+// timeout is zero or less
+func deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
 }
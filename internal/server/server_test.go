@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const getRequest = "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"
+
+func TestRequestContext(t *testing.T) {
+	// Test: Client disconnecting cancels the context while the handler runs
+	causes := make(chan error, 1)
+	s := serve(t, func(w *response.Writer, req *request.Request) {
+		select {
+		case <-req.Context().Done():
+			causes <- context.Cause(req.Context())
+		case <-time.After(5 * time.Second):
+			causes <- nil
+		}
+	})
+	conn := dial(t, s)
+	conn.Write([]byte(getRequest))
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+	assert.ErrorIs(t, <-causes, ErrClientDisconnected)
+
+	// Test: Closing the server cancels in-flight requests
+	started := make(chan struct{})
+	s = serve(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-req.Context().Done()
+		causes <- context.Cause(req.Context())
+	})
+	conn = dial(t, s)
+	conn.Write([]byte(getRequest))
+	<-started
+	s.Close()
+	assert.ErrorIs(t, <-causes, ErrServerClosed)
+
+	// Test: Context stays alive for a connected client and the response is sent
+	s = serve(t, func(w *response.Writer, req *request.Request) {
+		time.Sleep(50 * time.Millisecond)
+		causes <- req.Context().Err()
+		writeOK(w)
+	})
+	res := get(t, s)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.NoError(t, <-causes)
+}
+
+func TestTimeout(t *testing.T) {
+	// Test: Route deadline cancels the context
+	errs := make(chan error, 1)
+	s := serve(t, Chain(func(w *response.Writer, req *request.Request) {
+		<-req.Context().Done()
+		errs <- req.Context().Err()
+		writeOK(w)
+	}, Timeout(20*time.Millisecond)))
+	get(t, s)
+	assert.ErrorIs(t, <-errs, context.DeadlineExceeded)
+}
+
+func TestRequestValues(t *testing.T) {
+	// Test: Values attached by middleware are visible to the handler
+	type key struct{}
+	values := make(chan any, 1)
+	withValue := func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			next(w, req.WithValue(key{}, "tenant-7"))
+		}
+	}
+	s := serve(t, Chain(func(w *response.Writer, req *request.Request) {
+		values <- req.Value(key{})
+		writeOK(w)
+	}, withValue))
+	get(t, s)
+	assert.Equal(t, "tenant-7", <-values)
+}
+
+func TestShutdown(t *testing.T) {
+	// Test: In-flight request finishes before Shutdown returns
+	started := make(chan struct{})
+	s := serve(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		writeOK(w)
+	})
+	conn := dial(t, s)
+	conn.Write([]byte(getRequest))
+	<-started
+	require.NoError(t, s.Shutdown(context.Background()))
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+
+	// Test: New connections are refused once shut down
+	_, err = net.Dial(s.Addr().Network(), s.Addr().String())
+	assert.Error(t, err)
+
+	// Test: Requests still running when the deadline passes are cancelled
+	causes := make(chan error, 1)
+	started = make(chan struct{})
+	s = serve(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-req.Context().Done()
+		causes <- context.Cause(req.Context())
+	})
+	conn = dial(t, s)
+	conn.Write([]byte(getRequest))
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	assert.ErrorIs(t, <-causes, ErrServerClosed)
+}
+
+func serve(t *testing.T, handler Handler, opts ...Option) *Server {
+	t.Helper()
+
+	s, err := ListenAndServe("127.0.0.1:0", handler, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	return listener
+}
+
+func dial(t *testing.T, s *Server) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial(s.Addr().Network(), s.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func get(t *testing.T, s *Server) *http.Response {
+	t.Helper()
+
+	conn := dial(t, s)
+	_, err := conn.Write([]byte(getRequest))
+	require.NoError(t, err)
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	io.Copy(io.Discard, res.Body)
+	return res
+}
+
+func okHandler(w *response.Writer, _ *request.Request) {
+	writeOK(w)
+}
+
+func writeOK(w *response.Writer) {
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(0))
+}
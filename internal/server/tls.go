@@ -0,0 +1,175 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// How often the certificate files are checked for changes
+const certCheckInterval = time.Second
+
+// ServeTLS is like Serve but accepts TLS connections using config, which
+// must provide certificates through Certificates, GetCertificate or
+// GetConfigForClient.
+func ServeTLS(listener net.Listener, handler Handler, config *tls.Config, opts ...Option) (*Server, error) {
+	if config == nil || (len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil) {
+		return nil, errors.New("server: TLS config has no certificates")
+	}
+
+	config = config.Clone()
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"http/1.1"}
+	}
+
+	return Serve(tls.NewListener(listener, config), handler, opts...), nil
+}
+
+// ListenAndServeTLS is like ListenAndServe but accepts TLS connections using
+// the certificate and key in the given PEM files. The files are reloaded when
+// they change on disk, so renewed certificates are picked up without a
+// restart.
+func ListenAndServeTLS(addr string, handler Handler, certFile, keyFile string, opts ...Option) (*Server, error) {
+	certs, err := NewCertReloader(KeyPair{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return ServeTLS(listener, handler, &tls.Config{GetCertificate: certs.GetCertificate}, opts...)
+}
+
+type KeyPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// CertReloader serves certificates loaded from PEM files, choosing between
+// them by the server name the client asks for (SNI), and reloads a pair when
+// either file changes. Use its GetCertificate method in a tls.Config.
+type CertReloader struct {
+	// Logger receives reload errors, slog.Default() when nil
+	Logger *slog.Logger
+
+	mu        sync.RWMutex
+	pairs     []*certPair
+	lastCheck time.Time
+}
+
+type certPair struct {
+	KeyPair
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertReloader loads each key pair. The first pair is served to clients
+// that don't send a server name or match none of the certificates.
+func NewCertReloader(pairs ...KeyPair) (*CertReloader, error) {
+	if len(pairs) == 0 {
+		return nil, errors.New("server: no certificates given")
+	}
+
+	c := &CertReloader{lastCheck: time.Now()}
+	for _, kp := range pairs {
+		pair := &certPair{KeyPair: kp}
+		if err := pair.load(); err != nil {
+			return nil, err
+		}
+		c.pairs = append(c.pairs, pair)
+	}
+	return c, nil
+}
+
+// Reload reads every pair whose files changed since they were last loaded. A
+// pair that fails to load keeps serving its previous certificate.
+func (c *CertReloader) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastCheck = time.Now()
+	var errs []error
+	for _, pair := range c.pairs {
+		modTime, err := pair.latestModTime()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if modTime.Equal(pair.modTime) {
+			continue
+		}
+		if err := pair.load(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetCertificate returns the certificate for the client's server name,
+// checking the files for changes at most once per second.
+func (c *CertReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	stale := time.Since(c.lastCheck) >= certCheckInterval
+	c.mu.RUnlock()
+	if stale {
+		if err := c.Reload(); err != nil {
+			logger := c.Logger
+			if logger == nil {
+				logger = slog.Default()
+			}
+			logger.Error("reloading certificates", "error", err)
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if hello.ServerName != "" {
+		for _, pair := range c.pairs {
+			if hello.SupportsCertificate(pair.cert) == nil {
+				return pair.cert, nil
+			}
+		}
+	}
+	return c.pairs[0].cert, nil
+}
+
+func (p *certPair) load() error {
+	modTime, err := p.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(p.CertFile, p.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	p.cert = &cert
+	p.modTime = modTime
+	return nil
+}
+
+// The later of the two files' modification times, so replacing either one
+// triggers a reload
+func (p *certPair) latestModTime() (time.Time, error) {
+	certInfo, err := os.Stat(p.CertFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	keyInfo, err := os.Stat(p.KeyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if keyInfo.ModTime().After(certInfo.ModTime()) {
+		return keyInfo.ModTime(), nil
+	}
+	return certInfo.ModTime(), nil
+}
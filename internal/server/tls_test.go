@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenAndServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "localhost", "v1")
+
+	states := make(chan *tls.ConnectionState, 1)
+	s, err := ListenAndServeTLS("127.0.0.1:0", func(w *response.Writer, req *request.Request) {
+		states <- req.TLS
+		writeOK(w)
+	}, certFile, keyFile)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	// Test: Request over TLS exposes the negotiated state
+	conn := dialTLS(t, s, &tls.Config{ServerName: "localhost", InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}})
+	res := getOver(t, conn)
+	assert.Equal(t, 200, res.StatusCode)
+	state := <-states
+	require.NotNil(t, state)
+	assert.Equal(t, uint16(tls.VersionTLS13), state.Version)
+	assert.Equal(t, "http/1.1", state.NegotiatedProtocol)
+	assert.NotZero(t, state.CipherSuite)
+
+	// Test: Replaced certificate files are picked up without a restart
+	assert.Equal(t, "v1", servedCert(t, conn).Subject.OrganizationalUnit[0])
+	time.Sleep(certCheckInterval)
+	writeCertTo(t, certFile, keyFile, "localhost", "v2")
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	conn = dialTLS(t, s, &tls.Config{ServerName: "localhost", InsecureSkipVerify: true})
+	assert.Equal(t, "v2", servedCert(t, conn).Subject.OrganizationalUnit[0])
+	conn.Close()
+
+	// Test: Failed handshake closes the connection without a response
+	plain := dial(t, s)
+	plain.Write([]byte(getRequest))
+	data, _ := io.ReadAll(plain)
+	assert.NotContains(t, string(data), "HTTP/1.1")
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	aCert, aKey := writeCert(t, dir, "a.test", "a")
+	bCert, bKey := writeCert(t, dir, "b.test", "b")
+	certs, err := NewCertReloader(KeyPair{aCert, aKey}, KeyPair{bCert, bKey})
+	require.NoError(t, err)
+
+	// Test: Config without certificates is refused
+	_, err = ServeTLS(listen(t), nil, &tls.Config{})
+	assert.Error(t, err)
+
+	clientCert, clientKey := writeCert(t, dir, "client", "clients")
+	clientPair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	require.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientPair.Leaf)
+
+	names := make(chan string, 1)
+	s, err := ServeTLS(listen(t), func(w *response.Writer, req *request.Request) {
+		if len(req.TLS.PeerCertificates) > 0 {
+			names <- req.TLS.PeerCertificates[0].Subject.CommonName
+		} else {
+			names <- ""
+		}
+		writeOK(w)
+	}, &tls.Config{
+		GetCertificate: certs.GetCertificate,
+		ClientAuth:     tls.VerifyClientCertIfGiven,
+		ClientCAs:      clientCAs,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	// Test: Certificate is chosen by SNI, falling back to the first
+	for serverName, want := range map[string]string{"a.test": "a", "b.test": "b", "c.test": "a"} {
+		conn := dialTLS(t, s, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		assert.Equal(t, want, servedCert(t, conn).Subject.OrganizationalUnit[0], serverName)
+		conn.Close()
+	}
+
+	// Test: Client certificate is available for authorization
+	conn := dialTLS(t, s, &tls.Config{ServerName: "b.test", InsecureSkipVerify: true, Certificates: []tls.Certificate{clientPair}})
+	getOver(t, conn)
+	assert.Equal(t, "client", <-names)
+
+	// Test: Without a client certificate the peer list is empty
+	conn = dialTLS(t, s, &tls.Config{ServerName: "b.test", InsecureSkipVerify: true})
+	getOver(t, conn)
+	assert.Equal(t, "", <-names)
+
+	// Test: A client that never starts the handshake is dropped
+	s, err = ServeTLS(listen(t), okHandler, &tls.Config{GetCertificate: certs.GetCertificate}, HandshakeTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	idle := dial(t, s)
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = idle.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func dialTLS(t *testing.T, s *Server, config *tls.Config) *tls.Conn {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", s.Addr().String(), config)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func getOver(t *testing.T, conn *tls.Conn) *http.Response {
+	t.Helper()
+
+	_, err := conn.Write([]byte(getRequest))
+	require.NoError(t, err)
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	io.Copy(io.Discard, res.Body)
+	return res
+}
+
+func servedCert(t *testing.T, conn *tls.Conn) *x509.Certificate {
+	t.Helper()
+
+	certs := conn.ConnectionState().PeerCertificates
+	require.NotEmpty(t, certs)
+	return certs[0]
+}
+
+func writeCert(t *testing.T, dir, name, unit string) (string, string) {
+	t.Helper()
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	writeCertTo(t, certFile, keyFile, name, unit)
+	return certFile, keyFile
+}
+
+// Write a self-signed certificate for name, marked with unit so tests can
+// tell certificates apart
+func writeCertTo(t *testing.T, certFile, keyFile, name, unit string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name, OrganizationalUnit: []string{unit}},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Environment variables telling a process started by Upgrade how many
+// listeners it inherited and which descriptor reports it ready. The listeners
+// start at descriptor 3, followed by the ready pipe.
+const (
+	envUpgradeFDs   = "HTTPFROMTCP_UPGRADE_FDS"
+	envUpgradeReady = "HTTPFROMTCP_UPGRADE_READY_FD"
+)
+
+// Upgrade starts a new copy of the running executable with the same
+// arguments, handing it listeners, and waits until it calls Ready. The caller
+// should then stop accepting with Shutdown, letting in-flight requests finish
+// while the new process takes over the sockets. If the new process exits or
+// ctx ends before it's ready, it is killed and the caller keeps serving.
+//
+// The new process finds the sockets with InheritedListeners. Listeners must be
+// *net.TCPListener or *net.UnixListener, not ones wrapped for TLS.
+func Upgrade(ctx context.Context, listeners ...net.Listener) (*os.Process, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*os.File, 0, len(listeners)+1)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, l := range listeners {
+		f, err := listenerFile(l)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer ready.Close()
+	files = append(files, readyWriter)
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(withoutUpgradeEnv(os.Environ()),
+		envUpgradeFDs+"="+strconv.Itoa(len(listeners)),
+		envUpgradeReady+"="+strconv.Itoa(3+len(listeners)),
+	)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	// Only the child holds the write end now, so the read below ends when it
+	// either reports ready or exits
+	readyWriter.Close()
+	files = files[:len(files)-1]
+
+	readErr := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := ready.Read(buf)
+		readErr <- err
+	}()
+
+	select {
+	case err := <-readErr:
+		if err == nil {
+			// The new process keeps using any socket files after this one
+			// closes its listeners
+			for _, l := range listeners {
+				if ul, ok := l.(*net.UnixListener); ok {
+					ul.SetUnlinkOnClose(false)
+				}
+			}
+			// The child's lifetime is its own from here on
+			go cmd.Wait()
+			return cmd.Process, nil
+		}
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("server: upgraded process exited before it was ready: %w", err)
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, ctx.Err()
+	}
+}
+
+// InheritedListeners returns the listeners handed down by the process that
+// started this one with Upgrade, or none when it wasn't started that way.
+func InheritedListeners() ([]net.Listener, error) {
+	count, err := strconv.Atoi(os.Getenv(envUpgradeFDs))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+	os.Unsetenv(envUpgradeFDs)
+
+	return fileListeners(listenFDsStart, count, nil)
+}
+
+// Ready tells the process that started this one with Upgrade that it's
+// accepting connections, so the old process can shut down. It does nothing
+// when the process wasn't started by Upgrade.
+func Ready() error {
+	fd, err := strconv.Atoi(os.Getenv(envUpgradeReady))
+	if err != nil {
+		return nil
+	}
+	os.Unsetenv(envUpgradeReady)
+
+	f := os.NewFile(uintptr(fd), "upgrade-ready")
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// A duplicate of the listener's socket to pass to the new process
+func listenerFile(l net.Listener) (*os.File, error) {
+	switch l := l.(type) {
+	case *net.TCPListener:
+		return dupSocket(l, l.Addr().String())
+	case *net.UnixListener:
+		return dupSocket(l, l.Addr().String())
+	}
+	return nil, fmt.Errorf("server: cannot pass a %T to a new process", l)
+}
+
+func withoutUpgradeEnv(env []string) []string {
+	kept := make([]string, 0, len(env))
+	for _, kv := range env {
+		if strings.HasPrefix(kv, envUpgradeFDs+"=") || strings.HasPrefix(kv, envUpgradeReady+"=") {
+			continue
+		}
+		kept = append(kept, kv)
+	}
+	return kept
+}
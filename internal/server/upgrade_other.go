@@ -0,0 +1,13 @@
+//go:build !unix
+
+package server
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func dupSocket(sc syscall.Conn, name string) (*os.File, error) {
+	return nil, errors.New("server: passing sockets to a new process is not supported on this platform")
+}
@@ -0,0 +1,136 @@
+//go:build unix
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Set when the test binary runs as the server process for TestUpgrade
+const envUpgradeHelper = "HTTPFROMTCP_UPGRADE_HELPER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(envUpgradeHelper) == "1" {
+		upgradeHelper()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func TestUpgrade(t *testing.T) {
+	old := exec.Command(os.Args[0], "-test.run=^TestUpgrade$")
+	old.Env = append(os.Environ(), envUpgradeHelper+"=1")
+	old.Stderr = os.Stderr
+	stdout, err := old.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, old.Start())
+	t.Cleanup(func() { old.Process.Kill() })
+
+	addr, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	addr = strings.TrimSpace(addr)
+
+	// Test: Old process serves before the upgrade
+	assert.Equal(t, old.Process.Pid, getPID(t, addr, "/"))
+
+	// Test: Request in flight during the upgrade is finished by the old process
+	slow := make(chan int, 1)
+	go func() { slow <- getPID(t, addr, "/slow") }()
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, old.Process.Signal(syscall.SIGHUP))
+
+	// Test: New connections go to the new process while the old one drains
+	var newPID int
+	require.Eventually(t, func() bool {
+		newPID = getPID(t, addr, "/")
+		return newPID != old.Process.Pid
+	}, 5*time.Second, 10*time.Millisecond)
+	t.Cleanup(func() { syscall.Kill(newPID, syscall.SIGTERM) })
+	select {
+	case <-slow:
+		t.Fatal("slow request finished before the new process took over")
+	default:
+	}
+	assert.Equal(t, old.Process.Pid, <-slow)
+
+	// Test: Old process exits cleanly after draining
+	assert.NoError(t, old.Wait())
+	assert.Equal(t, newPID, getPID(t, addr, "/"))
+}
+
+// Send a request and return the pid of the process that answered
+func getPID(t *testing.T, addr, target string) int {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	body, _ := io.ReadAll(res.Body)
+	pid, _ := strconv.Atoi(string(body))
+	return pid
+}
+
+// Serve on a listener inherited from an upgrade or a new one, answering with
+// the process id, and upgrade on SIGHUP
+func upgradeHelper() {
+	listeners, err := InheritedListeners()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var listener net.Listener
+	if len(listeners) > 0 {
+		listener = listeners[0]
+	} else if listener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	body := []byte(strconv.Itoa(os.Getpid()))
+	s := Serve(listener, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/slow" {
+			time.Sleep(2 * time.Second)
+		}
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	})
+	Ready()
+	fmt.Println(listener.Addr())
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP, syscall.SIGTERM)
+	if <-sigChan == syscall.SIGHUP {
+		if _, err := Upgrade(context.Background(), listener); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	s.Shutdown(context.Background())
+}
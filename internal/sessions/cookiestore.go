@@ -0,0 +1,158 @@
+package sessions
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Shortest HMAC key accepted, in bytes
+const minHashKeySize = 32
+
+var ErrNoKeys = errors.New("cookie store needs a hash key")
+
+type CookieKeys struct {
+	// Hash keys sign cookies with HMAC-SHA256 and must be at least 32 random
+	// bytes. The first signs new cookies and all of them are accepted, so a
+	// key is rotated by putting a new one first and dropping the old one once
+	// the sessions it signed have expired.
+	Hash [][]byte
+	// Encryption keys, when given, encrypt cookies with AES-GCM so clients
+	// can't read the session. AES-128, -192 or -256 is chosen by the key's
+	// length, and the keys rotate like the hash keys.
+	Encryption [][]byte
+}
+
+// CookieStore keeps the session in the cookie itself, so it needs no
+// server-side state and works across servers sharing the keys. Sessions
+// can't be revoked though: a deleted or regenerated session's old cookie
+// stays valid until it expires. Browsers drop cookies over 4 KB, which
+// limits how much a session can hold.
+type CookieStore struct {
+	hashKeys [][]byte
+	aeads    []cipher.AEAD
+	now      func() time.Time
+}
+
+func NewCookieStore(keys CookieKeys) (*CookieStore, error) {
+	if len(keys.Hash) == 0 {
+		return nil, ErrNoKeys
+	}
+	for i, key := range keys.Hash {
+		if len(key) < minHashKeySize {
+			return nil, fmt.Errorf("hash key %d: shorter than %d bytes", i, minHashKeySize)
+		}
+	}
+
+	s := &CookieStore{hashKeys: keys.Hash, now: time.Now}
+	for i, key := range keys.Encryption {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %d: %w", i, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		s.aeads = append(s.aeads, aead)
+	}
+	return s, nil
+}
+
+// Cookies are the payload, encrypted when there are encryption keys, and
+// its MAC, both base64url and separated by a dot. The payload is the expiry
+// in Unix seconds followed by the values as JSON.
+func (s *CookieStore) Save(_ string, values map[string]string, expires time.Time) (string, error) {
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	payload := append(binary.BigEndian.AppendUint64(nil, uint64(expires.Unix())), encoded...)
+
+	if len(s.aeads) > 0 {
+		aead := s.aeads[0]
+		nonce := make([]byte, aead.NonceSize())
+		rand.Read(nonce)
+		payload = aead.Seal(nonce, nonce, payload, nil)
+	}
+
+	data := base64.RawURLEncoding.EncodeToString(payload)
+	return data + "." + base64.RawURLEncoding.EncodeToString(s.mac(s.hashKeys[0], data)), nil
+}
+
+func (s *CookieStore) Load(value string) (map[string]string, bool, error) {
+	data, mac, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, false, nil
+	}
+	given, err := base64.RawURLEncoding.DecodeString(mac)
+	if err != nil || !s.verify(data, given) {
+		return nil, false, nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return nil, false, nil
+	}
+	if len(s.aeads) > 0 {
+		if payload, ok = s.decrypt(payload); !ok {
+			return nil, false, nil
+		}
+	}
+
+	if len(payload) < 8 {
+		return nil, false, nil
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(payload)), 0)
+	if !s.now().Before(expires) {
+		return nil, false, nil
+	}
+	var values map[string]string
+	if err := json.Unmarshal(payload[8:], &values); err != nil {
+		return nil, false, nil
+	}
+	return values, true, nil
+}
+
+// Delete does nothing, as the session only exists in the cookie.
+func (s *CookieStore) Delete(string) error {
+	return nil
+}
+
+func (s *CookieStore) mac(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Every key is tried, so the timing doesn't reveal which one matched
+func (s *CookieStore) verify(data string, given []byte) bool {
+	valid := false
+	for _, key := range s.hashKeys {
+		if hmac.Equal(s.mac(key, data), given) {
+			valid = true
+		}
+	}
+	return valid
+}
+
+func (s *CookieStore) decrypt(payload []byte) ([]byte, bool) {
+	for _, aead := range s.aeads {
+		if len(payload) < aead.NonceSize() {
+			continue
+		}
+		nonce, ciphertext := payload[:aead.NonceSize()], payload[aead.NonceSize():]
+		if plaintext, err := aead.Open(nil, nonce, ciphertext, nil); err == nil {
+			return plaintext, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,110 @@
+package sessions
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	hashKey1 = bytes.Repeat([]byte{1}, 32)
+	hashKey2 = bytes.Repeat([]byte{2}, 32)
+	encKey1  = bytes.Repeat([]byte{3}, 32)
+	encKey2  = bytes.Repeat([]byte{4}, 16)
+)
+
+func TestCookieStore(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	newStore := func(keys CookieKeys) *CookieStore {
+		s, err := NewCookieStore(keys)
+		require.NoError(t, err)
+		s.now = func() time.Time { return now }
+		return s
+	}
+	values := map[string]string{"user": "alice"}
+
+	// Test: Signed cookies load back until they expire
+	store := newStore(CookieKeys{Hash: [][]byte{hashKey1}})
+	value, err := store.Save("", values, now.Add(time.Hour))
+	require.NoError(t, err)
+	loaded, ok, err := store.Load(value)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, values, loaded)
+
+	// Test: Signed cookies are readable but can't be changed
+	data, _, _ := strings.Cut(value, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(data)
+	require.NoError(t, err)
+	assert.Contains(t, string(payload), "alice")
+	forged := bytes.Replace(payload, []byte("alice"), []byte("admin"), 1)
+	_, ok, _ = store.Load(base64.RawURLEncoding.EncodeToString(forged) + value[len(data):])
+	assert.False(t, ok)
+	for _, bad := range []string{"", "nodot", "a.b", data + ".", "." + value} {
+		_, ok, _ = store.Load(bad)
+		assert.False(t, ok, bad)
+	}
+
+	// Test: Expired cookies are refused
+	later := newStore(CookieKeys{Hash: [][]byte{hashKey1}})
+	later.now = func() time.Time { return now.Add(time.Hour) }
+	_, ok, _ = later.Load(value)
+	assert.False(t, ok)
+
+	// Test: Rotated keys still verify old cookies, dropped ones don't
+	_, ok, _ = newStore(CookieKeys{Hash: [][]byte{hashKey2, hashKey1}}).Load(value)
+	assert.True(t, ok)
+	_, ok, _ = newStore(CookieKeys{Hash: [][]byte{hashKey2}}).Load(value)
+	assert.False(t, ok)
+
+	// Test: Encrypted cookies hide the values and rotate the same way
+	encrypted := newStore(CookieKeys{Hash: [][]byte{hashKey1}, Encryption: [][]byte{encKey1}})
+	value, err = encrypted.Save("", values, now.Add(time.Hour))
+	require.NoError(t, err)
+	data, _, _ = strings.Cut(value, ".")
+	payload, err = base64.RawURLEncoding.DecodeString(data)
+	require.NoError(t, err)
+	assert.NotContains(t, string(payload), "alice")
+
+	rotated := newStore(CookieKeys{Hash: [][]byte{hashKey1}, Encryption: [][]byte{encKey2, encKey1}})
+	loaded, ok, _ = rotated.Load(value)
+	assert.True(t, ok)
+	assert.Equal(t, values, loaded)
+	_, ok, _ = newStore(CookieKeys{Hash: [][]byte{hashKey1}, Encryption: [][]byte{encKey2}}).Load(value)
+	assert.False(t, ok)
+	_, ok, _ = store.Load(value)
+	assert.False(t, ok)
+}
+
+func TestNewCookieStore(t *testing.T) {
+	// Test: Missing, short and badly sized keys are refused
+	_, err := NewCookieStore(CookieKeys{})
+	assert.ErrorIs(t, err, ErrNoKeys)
+	_, err = NewCookieStore(CookieKeys{Hash: [][]byte{[]byte("short")}})
+	assert.Error(t, err)
+	_, err = NewCookieStore(CookieKeys{Hash: [][]byte{hashKey1}, Encryption: [][]byte{[]byte("not-an-aes-key")}})
+	assert.Error(t, err)
+}
+
+func TestMiddlewareCookieStore(t *testing.T) {
+	store, err := NewCookieStore(CookieKeys{Hash: [][]byte{hashKey1}, Encryption: [][]byte{encKey1}})
+	require.NoError(t, err)
+	opts := Options{Store: store, Name: "__Host-session"}
+
+	// Test: The whole session travels in the cookie
+	res, _ := serve(t, opts, "X-Action: login\r\n", &tls.ConnectionState{})
+	c := sessionCookie(t, res)
+	assert.True(t, c.Secure)
+	_, body := serve(t, opts, "Cookie: __Host-session="+c.Value+"\r\n", nil)
+	assert.Equal(t, "alice", body)
+
+	// Test: A __Host- cookie can't be set without Secure, so none is
+	res, _ = serve(t, opts, "X-Action: login\r\n", nil)
+	assert.Empty(t, res.Cookies())
+}
@@ -0,0 +1,235 @@
+package sessions
+
+import (
+	"context"
+	"httpfromtcp/internal/cookie"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"io"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+)
+
+// Cookie holding the session unless Options.Name is given
+const DefaultName = "session"
+
+// How long sessions last unless Options.MaxAge is given
+const DefaultMaxAge = 24 * time.Hour
+
+type Options struct {
+	// Store keeps the sessions, a new MemoryStore when nil
+	Store Store
+	// Name of the cookie, DefaultName when empty
+	Name string
+	// MaxAge is how long a session lasts after it was last changed,
+	// DefaultMaxAge when zero
+	MaxAge time.Duration
+
+	// Path and Domain of the cookie. Path defaults to /, and leaving Domain
+	// empty keeps subdomains from receiving the cookie.
+	Path   string
+	Domain string
+	// Secure makes browsers only send the cookie over HTTPS. Cookies set on
+	// requests received over TLS are always Secure.
+	Secure bool
+	// SameSite defaults to Lax, so browsers don't send the cookie with
+	// cross-site POSTs and the like. That keeps other sites from making
+	// requests in the user's session, as long as GET requests don't change
+	// anything.
+	SameSite cookie.SameSite
+}
+
+// Session holds a client's values between requests. Changes are saved when
+// the response headers are written, so they must be made before. A nil
+// Session, as FromContext returns outside of Middleware, is empty and
+// discards changes, so handlers don't need to check for it.
+type Session struct {
+	mu     sync.Mutex
+	values map[string]string
+	// Cookie value the session was loaded from, empty for a new session
+	loaded string
+	// Whether the request had a session cookie, valid or not
+	sent        bool
+	changed     bool
+	regenerated bool
+	destroyed   bool
+}
+
+type contextKey struct{}
+
+// Middleware loads the session named by the request's cookie, or starts a
+// new one, and makes it available from FromContext. Sessions are only saved,
+// and the cookie only set, when they change. The cookie is HttpOnly so
+// scripts can't read it.
+func Middleware(opts Options) server.Middleware {
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	if opts.Name == "" {
+		opts.Name = DefaultName
+	}
+	if opts.MaxAge == 0 {
+		opts.MaxAge = DefaultMaxAge
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.SameSite == cookie.SameSiteDefault {
+		opts.SameSite = cookie.SameSiteLax
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			s := &Session{values: map[string]string{}}
+			if c, ok := req.Cookie(opts.Name); ok {
+				s.sent = true
+				values, found, err := opts.Store.Load(c.Value)
+				if err != nil {
+					// Carry on with a new session, which is all a client
+					// with a stale cookie would get anyway
+					slog.ErrorContext(req.Context(), "loading session", "error", err)
+				} else if found {
+					s.values = values
+					s.loaded = c.Value
+				}
+			}
+
+			w.AddFilter(&filter{opts: &opts, session: s, req: req})
+			next(w, req.WithValue(contextKey{}, s))
+		}
+	}
+}
+
+// FromContext returns the request's session, or nil outside of Middleware,
+// which is safe to use but keeps nothing.
+func FromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(contextKey{}).(*Session)
+	return s
+}
+
+func (s *Session) Get(key string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	return value, ok
+}
+
+func (s *Session) Set(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	s.changed = true
+	s.destroyed = false
+}
+
+func (s *Session) Delete(key string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.changed = true
+	}
+}
+
+// Regenerate moves the values to a new session and ends the old one. Call it
+// whenever the user's privileges change, such as on login, so a session ID
+// an attacker planted in the browser before doesn't gain them.
+func (s *Session) Regenerate() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.regenerated = true
+	s.changed = true
+	s.destroyed = false
+}
+
+// Destroy clears the values, ends the session and removes the cookie, for
+// logging out.
+func (s *Session) Destroy() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.values)
+	s.destroyed = true
+	s.changed = false
+	// Values set afterwards go in a new session
+	s.regenerated = true
+}
+
+// Saves the session and sets the cookie when the headers are written
+type filter struct {
+	opts    *Options
+	session *Session
+	req     *request.Request
+}
+
+func (f *filter) Headers(_ response.StatusCode, h headers.Headers) {
+	s := f.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := &cookie.Cookie{
+		Name:     f.opts.Name,
+		Path:     f.opts.Path,
+		Domain:   f.opts.Domain,
+		Secure:   f.opts.Secure || f.req.TLS != nil,
+		HttpOnly: true,
+		SameSite: f.opts.SameSite,
+	}
+
+	ctx := f.req.Context()
+	if s.regenerated && s.loaded != "" {
+		if err := f.opts.Store.Delete(s.loaded); err != nil {
+			slog.ErrorContext(ctx, "deleting session", "error", err)
+		}
+		s.loaded = ""
+	}
+
+	switch {
+	case s.destroyed:
+		if !s.sent {
+			return
+		}
+		c.MaxAge = -1
+	case s.changed:
+		value, err := f.opts.Store.Save(s.loaded, maps.Clone(s.values), time.Now().Add(f.opts.MaxAge))
+		if err != nil {
+			slog.ErrorContext(ctx, "saving session", "error", err)
+			return
+		}
+		c.Value = value
+		c.MaxAge = int(f.opts.MaxAge.Seconds())
+	default:
+		return
+	}
+
+	if err := cookie.Set(h, c); err != nil {
+		slog.ErrorContext(ctx, "setting session cookie", "error", err)
+		return
+	}
+	// Shared caches mustn't hand the cookie to other clients
+	if _, ok := h.Get("Cache-Control"); !ok {
+		h.Set("Cache-Control", "no-store")
+	}
+}
+
+func (f *filter) Body(io.Writer) io.WriteCloser {
+	return nil
+}
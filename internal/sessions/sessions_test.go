@@ -0,0 +1,142 @@
+package sessions
+
+import (
+	"crypto/tls"
+	"httpfromtcp/internal/handlertest"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Changes the session as the X-Action header says and answers with the
+// user value
+func sessionHandler(w *response.Writer, req *request.Request) {
+	s := FromContext(req.Context())
+	action, _ := req.Headers.Get("X-Action")
+	switch action {
+	case "login":
+		s.Regenerate()
+		s.Set("user", "alice")
+	case "logout":
+		s.Destroy()
+	case "forget":
+		s.Delete("user")
+	}
+
+	user, _ := s.Get("user")
+	body := []byte(user)
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func serve(t *testing.T, opts Options, header string, tlsState *tls.ConnectionState) (*http.Response, string) {
+	t.Helper()
+	req := handlertest.NewRequest(t, "GET", "/", header, "")
+	req.TLS = tlsState
+	return handlertest.Serve(t, Middleware(opts)(sessionHandler), req)
+}
+
+func sessionCookie(t *testing.T, res *http.Response) *http.Cookie {
+	t.Helper()
+	cookies := res.Cookies()
+	require.Len(t, cookies, 1)
+	return cookies[0]
+}
+
+func TestMiddleware(t *testing.T) {
+	store := NewMemoryStore()
+	opts := Options{Store: store, MaxAge: time.Hour}
+
+	// Test: Unchanged sessions set no cookie
+	res, body := serve(t, opts, "", nil)
+	assert.Empty(t, res.Cookies())
+	assert.Empty(t, body)
+
+	// Test: Logging in sets a cookie with safe defaults
+	res, _ = serve(t, opts, "X-Action: login\r\n", nil)
+	c := sessionCookie(t, res)
+	assert.Equal(t, DefaultName, c.Name)
+	assert.Equal(t, "/", c.Path)
+	assert.Equal(t, 3600, c.MaxAge)
+	assert.True(t, c.HttpOnly)
+	assert.False(t, c.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, c.SameSite)
+	assert.Equal(t, "no-store", res.Header.Get("Cache-Control"))
+
+	// Test: The cookie brings the session back
+	_, body = serve(t, opts, "Cookie: session="+c.Value+"\r\n", nil)
+	assert.Equal(t, "alice", body)
+
+	// Test: Logging in again moves the session to a new ID
+	res, _ = serve(t, opts, "Cookie: session="+c.Value+"\r\n"+"X-Action: login\r\n", nil)
+	regenerated := sessionCookie(t, res)
+	assert.NotEqual(t, c.Value, regenerated.Value)
+	_, body = serve(t, opts, "Cookie: session="+c.Value+"\r\n", nil)
+	assert.Empty(t, body)
+
+	// Test: Deleting a value saves the session under the same ID
+	res, body = serve(t, opts, "Cookie: session="+regenerated.Value+"\r\nX-Action: forget\r\n", nil)
+	assert.Empty(t, body)
+	assert.Equal(t, regenerated.Value, sessionCookie(t, res).Value)
+
+	// Test: Logging out removes the cookie and the session
+	res, _ = serve(t, opts, "Cookie: session="+regenerated.Value+"\r\nX-Action: login\r\n", nil)
+	c = sessionCookie(t, res)
+	res, _ = serve(t, opts, "Cookie: session="+c.Value+"\r\nX-Action: logout\r\n", nil)
+	assert.Equal(t, -1, sessionCookie(t, res).MaxAge)
+	assert.Empty(t, store.sessions)
+
+	// Test: Logging out without a session sets no cookie
+	res, _ = serve(t, opts, "X-Action: logout\r\n", nil)
+	assert.Empty(t, res.Cookies())
+
+	// Test: IDs the store didn't issue aren't adopted
+	res, _ = serve(t, opts, "Cookie: session=chosen-by-attacker\r\nX-Action: forget\r\n", nil)
+	assert.Empty(t, res.Cookies())
+	res, _ = serve(t, opts, "Cookie: session=chosen-by-attacker\r\nX-Action: login\r\n", nil)
+	assert.NotEqual(t, "chosen-by-attacker", sessionCookie(t, res).Value)
+
+	// Test: Cookies set over TLS are Secure
+	res, _ = serve(t, opts, "X-Action: login\r\n", &tls.ConnectionState{})
+	assert.True(t, sessionCookie(t, res).Secure)
+
+	// Test: Without the middleware the session is empty and keeps nothing
+	req := handlertest.NewRequest(t, "GET", "/", "X-Action: login\r\n", "")
+	assert.NotPanics(t, func() {
+		res, body := handlertest.Serve(t, sessionHandler, req)
+		assert.Empty(t, body)
+		assert.Empty(t, res.Cookies())
+	})
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	store.lastSweep = now
+
+	// Test: Sessions load until they expire
+	id, err := store.Save("", map[string]string{"user": "alice"}, now.Add(time.Hour))
+	require.NoError(t, err)
+	values, ok, err := store.Load(id)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"user": "alice"}, values)
+
+	now = now.Add(time.Hour)
+	_, ok, _ = store.Load(id)
+	assert.False(t, ok)
+
+	// Test: Saving an expired session gives it a new ID, and expired ones are
+	// swept
+	newID, err := store.Save(id, map[string]string{}, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.NotEqual(t, id, newID)
+	assert.Len(t, store.sessions, 1)
+}
@@ -0,0 +1,102 @@
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"maps"
+	"sync"
+	"time"
+)
+
+// How often MemoryStore looks for expired sessions it can drop
+const sweepInterval = time.Minute
+
+// Store keeps session values. The cookie holds whatever the store needs to
+// find them again: an ID for a server-side store, or the values themselves
+// for CookieStore. Stores must be safe for concurrent use.
+type Store interface {
+	// Load returns the values of the session the cookie value refers to, ok
+	// false if there's no such session, it expired or the cookie was
+	// tampered with.
+	Load(value string) (values map[string]string, ok bool, err error)
+	// Save keeps the values until expires and returns the cookie value
+	// referring to them. value is the cookie the session was loaded from,
+	// empty for a new session.
+	Save(value string, values map[string]string, expires time.Time) (string, error)
+	// Delete ends the session the cookie value refers to.
+	Delete(value string) error
+}
+
+// MemoryStore keeps sessions in memory under random IDs, so they're lost
+// when the server restarts and not shared between servers. IDs it didn't
+// issue are never adopted, so a client can't choose its own.
+type MemoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]*entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type entry struct {
+	values  map[string]string
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions:  map[string]*entry{},
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (m *MemoryStore) Load(id string) (map[string]string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.sessions[id]
+	if !ok || !m.now().Before(e.expires) {
+		return nil, false, nil
+	}
+	return maps.Clone(e.values), true, nil
+}
+
+func (m *MemoryStore) Save(id string, values map[string]string, expires time.Time) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+	}
+
+	if e, ok := m.sessions[id]; !ok || !now.Before(e.expires) {
+		id = newID()
+	}
+	m.sessions[id] = &entry{values: maps.Clone(values), expires: expires}
+	return id, nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// Drop every expired session
+func (m *MemoryStore) sweep(now time.Time) {
+	m.lastSweep = now
+	for id, e := range m.sessions {
+		if !now.Before(e.expires) {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+// 256 random bits, so IDs can't be guessed
+func newID() string {
+	var b [32]byte
+	rand.Read(b[:])
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
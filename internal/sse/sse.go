@@ -0,0 +1,203 @@
+package sse
+
+import (
+	"errors"
+	"fmt"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default interval between heartbeat comments
+const DefaultHeartbeat = 15 * time.Second
+
+var ErrClosed = errors.New("sse: stream closed")
+
+type Event struct {
+	// ID is stored by the browser and sent back as Last-Event-ID when it
+	// reconnects
+	ID string
+	// Event is the event type, "message" when empty
+	Event string
+	// Data may span multiple lines, each sent as its own data field
+	Data string
+	// Retry tells the browser how long to wait before reconnecting
+	Retry time.Duration
+}
+
+type Options struct {
+	// Interval between heartbeat comments that keep intermediaries from
+	// timing out an idle stream and reveal a disconnected client. Zero
+	// selects DefaultHeartbeat and a negative value disables heartbeats.
+	Heartbeat time.Duration
+}
+
+// Writer sends a text/event-stream response. It's safe for concurrent use.
+type Writer struct {
+	w           *response.Writer
+	lastEventID string
+
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{}
+	stop   chan struct{}
+}
+
+// NewWriter writes the headers of an event stream and starts sending
+// heartbeats. The handler should call Close when it's done sending events.
+func NewWriter(w *response.Writer, req *request.Request, opts Options) (*Writer, error) {
+	headers := response.GetDefaultHeaders(0)
+	headers.Remove("Content-Length")
+	headers.Replace("Content-Type", "text/event-stream")
+	headers.Set("Cache-Control", "no-cache")
+	headers.Set("Transfer-Encoding", "chunked")
+	// Stop reverse proxies such as nginx from buffering the stream
+	headers.Set("X-Accel-Buffering", "no")
+
+	if err := w.WriteStatusLine(response.StatusOK); err != nil {
+		return nil, err
+	}
+	if err := w.WriteHeaders(headers); err != nil {
+		return nil, err
+	}
+
+	lastEventID, _ := req.Headers.Get("Last-Event-ID")
+	sw := &Writer{
+		w:           w,
+		lastEventID: lastEventID,
+		done:        make(chan struct{}),
+		stop:        make(chan struct{}),
+	}
+
+	heartbeat := opts.Heartbeat
+	if heartbeat == 0 {
+		heartbeat = DefaultHeartbeat
+	}
+	go sw.watch(req, heartbeat)
+
+	return sw, nil
+}
+
+// LastEventID returns the ID of the last event the client saw before it
+// reconnected, or an empty string on a fresh connection.
+func (sw *Writer) LastEventID() string {
+	return sw.lastEventID
+}
+
+// Done is closed once the stream ends: when Close is called, the request
+// context is cancelled because the client disconnected, or a write fails.
+func (sw *Writer) Done() <-chan struct{} {
+	return sw.done
+}
+
+// Send writes an event and flushes it to the client.
+func (sw *Writer) Send(e Event) error {
+	if strings.ContainsAny(e.ID, "\r\n\x00") {
+		return fmt.Errorf("sse: invalid event id %q", e.ID)
+	}
+	if strings.ContainsAny(e.Event, "\r\n") {
+		return fmt.Errorf("sse: invalid event type %q", e.Event)
+	}
+
+	var b strings.Builder
+	if e.ID != "" {
+		b.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Event != "" {
+		b.WriteString("event: " + e.Event + "\n")
+	}
+	if e.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+
+	// Any line ending in the data starts a new data field
+	data := strings.ReplaceAll(e.Data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+
+	return sw.write(b.String())
+}
+
+// Comment writes a comment line, which clients ignore.
+func (sw *Writer) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		b.WriteString(": " + strings.TrimRight(line, "\r") + "\n")
+	}
+	b.WriteString("\n")
+
+	return sw.write(b.String())
+}
+
+// Close stops the heartbeat and ends the response.
+func (sw *Writer) Close() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.closed {
+		return nil
+	}
+	sw.shutdown()
+
+	_, err := sw.w.WriteChunkedBodyDone()
+	return err
+}
+
+func (sw *Writer) write(s string) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.closed {
+		return ErrClosed
+	}
+
+	// Each event is written as one chunk straight to the connection
+	if _, err := sw.w.WriteChunkedBody([]byte(s)); err != nil {
+		sw.shutdown()
+		return err
+	}
+	return nil
+}
+
+// Sends heartbeats, unless interval is negative, and ends the stream as
+// soon as the request context is cancelled
+func (sw *Writer) watch(req *request.Request, interval time.Duration) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-tick:
+			if err := sw.Comment("heartbeat"); err != nil {
+				return
+			}
+		case <-req.Context().Done():
+			// The connection is gone, so the body can't be ended
+			sw.mu.Lock()
+			if !sw.closed {
+				sw.shutdown()
+			}
+			sw.mu.Unlock()
+			return
+		case <-sw.stop:
+			return
+		}
+	}
+}
+
+// Mark the stream closed; the caller must hold the lock
+func (sw *Writer) shutdown() {
+	sw.closed = true
+	close(sw.stop)
+	close(sw.done)
+}
@@ -0,0 +1,144 @@
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter(t *testing.T) {
+	var buf syncBuffer
+	sw, err := NewWriter(response.NewWriter(&buf), newRequest(t, "Last-Event-ID: 41\r\n"), Options{Heartbeat: -1})
+	require.NoError(t, err)
+
+	// Test: Last-Event-ID from the reconnecting client
+	assert.Equal(t, "41", sw.LastEventID())
+
+	// Test: Event with every field and multi-line data
+	require.NoError(t, sw.Send(Event{ID: "42", Event: "update", Data: "line one\nline two\r\nline three", Retry: 3 * time.Second}))
+
+	// Test: Data-only event and comment
+	require.NoError(t, sw.Send(Event{Data: "plain"}))
+	require.NoError(t, sw.Comment("keep going"))
+
+	// Test: Invalid fields are refused
+	assert.Error(t, sw.Send(Event{ID: "4\n2"}))
+	assert.Error(t, sw.Send(Event{Event: "a\rb"}))
+
+	require.NoError(t, sw.Close())
+	assert.ErrorIs(t, sw.Send(Event{Data: "late"}), ErrClosed)
+	<-sw.Done()
+
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf.Bytes())), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", res.Header.Get("Cache-Control"))
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "id: 42\nevent: update\nretry: 3000\ndata: line one\ndata: line two\ndata: line three\n\n"+
+		"data: plain\n\n"+
+		": keep going\n\n", string(body))
+}
+
+func TestWriterHeartbeat(t *testing.T) {
+	// Test: Heartbeat comments are sent while idle
+	var buf syncBuffer
+	sw, err := NewWriter(response.NewWriter(&buf), newRequest(t, ""), Options{Heartbeat: 10 * time.Millisecond})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return strings.Contains(buf.String(), ": heartbeat\n\n")
+	}, time.Second, 5*time.Millisecond)
+	require.NoError(t, sw.Close())
+
+	// Test: A failed write after the client disconnects ends the stream
+	fw := &failingWriter{}
+	sw, err = NewWriter(response.NewWriter(fw), newRequest(t, ""), Options{Heartbeat: 10 * time.Millisecond})
+	require.NoError(t, err)
+	fw.fail()
+	select {
+	case <-sw.Done():
+	case <-time.After(time.Second):
+		t.Fatal("stream not closed after disconnect")
+	}
+	assert.ErrorIs(t, sw.Send(Event{Data: "x"}), ErrClosed)
+}
+
+func TestWriterContext(t *testing.T) {
+	// Test: A cancelled request context ends the stream without waiting for
+	// a write, even with heartbeats off
+	ctx, cancel := context.WithCancel(context.Background())
+	var buf syncBuffer
+	sw, err := NewWriter(response.NewWriter(&buf), newRequest(t, "").WithContext(ctx), Options{Heartbeat: -1})
+	require.NoError(t, err)
+	cancel()
+	select {
+	case <-sw.Done():
+	case <-time.After(time.Second):
+		t.Fatal("stream not closed after the context was cancelled")
+	}
+	assert.ErrorIs(t, sw.Send(Event{Data: "x"}), ErrClosed)
+	assert.NoError(t, sw.Close())
+	assert.NotContains(t, buf.String(), "0\r\n\r\n")
+}
+
+func newRequest(t *testing.T, reqHeaders string) *request.Request {
+	t.Helper()
+
+	req, err := request.RequestFromReader(strings.NewReader("GET /events HTTP/1.1\r\nHost: localhost\r\n" + reqHeaders + "\r\n"))
+	require.NoError(t, err)
+	return req
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf.Bytes())
+}
+
+func (b *syncBuffer) String() string {
+	return string(b.Bytes())
+}
+
+// Accepts writes until fail is called, like a connection whose peer left
+type failingWriter struct {
+	mu     sync.Mutex
+	failed bool
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failed {
+		return 0, errors.New("broken pipe")
+	}
+	return len(p), nil
+}
+
+func (w *failingWriter) fail() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.failed = true
+}
@@ -0,0 +1,173 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// Trace flag telling downstream services the trace is being recorded
+const FlagSampled = 0x01
+
+// Limits on tracestate from the W3C Trace Context spec
+const (
+	maxTraceStateMembers = 32
+	maxTraceStateValue   = 256
+)
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+func (id SpanID) IsValid() bool  { return id != SpanID{} }
+
+// SpanContext is the part of a span that crosses service boundaries in the
+// traceparent and tracestate headers.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	// Vendor specific trace data, passed on unchanged
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+// Traceparent formats the span context as a version 00 traceparent header.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags&FlagSampled)
+}
+
+// ParseTraceparent parses a traceparent header. Versions newer than 00 are
+// accepted as long as they start with the fields version 00 defines.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	s = strings.TrimSpace(s)
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return sc, ErrInvalidTraceparent
+	}
+
+	version, ok := parseHex(s[:2])
+	if !ok || version[0] == 0xff {
+		return sc, ErrInvalidTraceparent
+	}
+	// Version 00 has nothing after the flags, later versions may add fields
+	if version[0] == 0 && len(s) != 55 || len(s) > 55 && s[55] != '-' {
+		return sc, ErrInvalidTraceparent
+	}
+
+	traceID, ok1 := parseHex(s[3:35])
+	spanID, ok2 := parseHex(s[36:52])
+	flags, ok3 := parseHex(s[53:55])
+	if !ok1 || !ok2 || !ok3 {
+		return sc, ErrInvalidTraceparent
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// Lowercase hex only, as the spec requires
+func parseHex(s string) ([]byte, bool) {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return nil, false
+		}
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+// ValidTraceState reports whether s is a well-formed tracestate header. An
+// invalid one is dropped rather than passed on.
+func ValidTraceState(s string) bool {
+	seen := map[string]bool{}
+	members := 0
+	for member := range strings.SplitSeq(s, ",") {
+		member = strings.Trim(member, " \t")
+		if member == "" {
+			continue
+		}
+		members++
+		key, value, ok := strings.Cut(member, "=")
+		if !ok || members > maxTraceStateMembers || seen[key] ||
+			!validTraceStateKey(key) || !validTraceStateValue(value) {
+			return false
+		}
+		seen[key] = true
+	}
+	return true
+}
+
+// A simple key, or a tenant@system key for multi-tenant vendors
+func validTraceStateKey(key string) bool {
+	if tenant, system, ok := strings.Cut(key, "@"); ok {
+		return validKeyPart(tenant, 241, true) && validKeyPart(system, 14, false)
+	}
+	return validKeyPart(key, 256, false)
+}
+
+func validKeyPart(s string, maxLen int, digitFirst bool) bool {
+	if s == "" || len(s) > maxLen {
+		return false
+	}
+	for i, c := range s {
+		lower := 'a' <= c && c <= 'z'
+		digit := '0' <= c && c <= '9'
+		switch {
+		case i == 0 && !lower && !(digitFirst && digit):
+			return false
+		case !lower && !digit && !strings.ContainsRune("_-*/", c):
+			return false
+		}
+	}
+	return true
+}
+
+// Printable ASCII except comma and equals, not ending in a space
+func validTraceStateValue(value string) bool {
+	if value == "" || len(value) > maxTraceStateValue || value[len(value)-1] == ' ' {
+		return false
+	}
+	for _, c := range value {
+		if c < 0x20 || c > 0x7e || c == ',' || c == '=' {
+			return false
+		}
+	}
+	return true
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
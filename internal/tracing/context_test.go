@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	// Test: Valid version 00 header
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled())
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	// Test: Later versions may add fields, and only known flags are passed on
+	sc, err = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-03-extra")
+	require.NoError(t, err)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	// Test: Malformed headers are rejected
+	for _, header := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01x",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(header)
+		assert.ErrorIs(t, err, ErrInvalidTraceparent, header)
+	}
+}
+
+func TestValidTraceState(t *testing.T) {
+	// Test: Simple and multi-tenant keys, optional whitespace, empty members
+	assert.True(t, ValidTraceState("rojo=00f067aa0ba902b7,congo=t61rcWkgMzE"))
+	assert.True(t, ValidTraceState("tenant1@vendor=value, ,  foo=bar baz"))
+	assert.True(t, ValidTraceState(""))
+
+	// Test: Bad keys, values, duplicates and too many members
+	assert.False(t, ValidTraceState("Rojo=1"))
+	assert.False(t, ValidTraceState("rojo"))
+	assert.False(t, ValidTraceState("rojo=a=b"))
+	assert.False(t, ValidTraceState("rojo=a\x01b"))
+	assert.False(t, ValidTraceState("rojo=1,rojo=2"))
+	assert.False(t, ValidTraceState("@vendor=1"))
+	members := make([]string, 33)
+	for i := range members {
+		members[i] = "k" + strings.Repeat("a", i) + "=v"
+	}
+	assert.False(t, ValidTraceState(strings.Join(members, ",")))
+	assert.True(t, ValidTraceState(strings.Join(members[:32], ",")))
+}
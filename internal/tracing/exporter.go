@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Exporter sends finished spans somewhere they can be looked at. Export is
+// called concurrently, once per sampled span, from the goroutine ending it.
+type Exporter interface {
+	Export(span *Span)
+}
+
+// JSONExporter writes each span as a line of JSON, for reading by a log
+// collector.
+type JSONExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{w: w}
+}
+
+type jsonSpan struct {
+	Name         string         `json:"name"`
+	Kind         SpanKind       `json:"kind"`
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	TraceState   string         `json:"trace_state,omitempty"`
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	DurationMS   float64        `json:"duration_ms"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
+
+func (e *JSONExporter) Export(span *Span) {
+	record := jsonSpan{
+		Name:       span.Name,
+		Kind:       span.Kind,
+		TraceID:    span.Context.TraceID.String(),
+		SpanID:     span.Context.SpanID.String(),
+		TraceState: span.Context.TraceState,
+		Start:      span.StartTime,
+		End:        span.EndTime,
+		DurationMS: float64(span.EndTime.Sub(span.StartTime).Microseconds()) / 1000,
+		Attributes: span.Attributes(),
+		Error:      span.Error,
+	}
+	if span.Parent.IsValid() {
+		record.ParentSpanID = span.Parent.String()
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(append(line, '\n'))
+}
+
+// MemoryExporter keeps spans in memory, for tests.
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *MemoryExporter) Export(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the spans exported so far, in the order they ended.
+func (e *MemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.spans)
+}
+
+func (e *MemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONExporter(t *testing.T) {
+	var out bytes.Buffer
+	parent := newSpan("GET /", KindServer, SpanContext{}, NewJSONExporter(&out))
+	ctx := ContextWithSpan(context.Background(), parent)
+	_, child := StartSpan(ctx, "lookup", KindInternal)
+	child.SetAttribute("db.rows", 3)
+	child.SetError(errors.New("timed out"))
+	child.End()
+	parent.End()
+	// Test: Ending twice doesn't export twice
+	parent.End()
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	var first, second map[string]any
+	require.NoError(t, json.Unmarshal(lines[0], &first))
+	require.NoError(t, json.Unmarshal(lines[1], &second))
+
+	// Test: One line per span in the order they ended, linked by IDs
+	assert.Equal(t, "lookup", first["name"])
+	assert.Equal(t, "internal", first["kind"])
+	assert.Equal(t, parent.Context.TraceID.String(), first["trace_id"])
+	assert.Equal(t, parent.Context.SpanID.String(), first["parent_span_id"])
+	assert.Equal(t, map[string]any{"db.rows": float64(3)}, first["attributes"])
+	assert.Equal(t, "timed out", first["error"])
+	assert.Equal(t, "GET /", second["name"])
+	assert.NotContains(t, second, "parent_span_id")
+	assert.Contains(t, second, "duration_ms")
+}
+
+func TestMemoryExporter(t *testing.T) {
+	exporter := &MemoryExporter{}
+
+	// Test: Sampled spans are kept, unsampled ones aren't exported
+	newSpan("sampled", KindServer, SpanContext{}, exporter).End()
+	unsampled := SpanContext{TraceID: newTraceID(), SpanID: newSpanID()}
+	newSpan("unsampled", KindServer, unsampled, exporter).End()
+	spans := exporter.Spans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "sampled", spans[0].Name)
+
+	exporter.Reset()
+	assert.Empty(t, exporter.Spans())
+}
@@ -0,0 +1,139 @@
+package tracing
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type SpanKind string
+
+const (
+	// KindServer spans cover a request this server handled
+	KindServer SpanKind = "server"
+	// KindClient spans cover a request this server made to another service
+	KindClient   SpanKind = "client"
+	KindInternal SpanKind = "internal"
+)
+
+// Span is a timed operation within a trace. Its fields are read-only and
+// complete once End has been called.
+type Span struct {
+	Name      string
+	Kind      SpanKind
+	Context   SpanContext
+	Parent    SpanID
+	StartTime time.Time
+	EndTime   time.Time
+	// Error describes why the operation failed, empty if it didn't
+	Error string
+
+	mu         sync.Mutex
+	attributes map[string]any
+	exporter   Exporter
+	ended      bool
+}
+
+// SetAttribute records a key/value pair describing the operation. Keys
+// follow the OpenTelemetry semantic conventions where one fits.
+func (s *Span) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[key] = value
+}
+
+// Attributes returns a copy of the span's attributes.
+func (s *Span) Attributes() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.attributes)
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Error = err.Error()
+}
+
+// End completes the span and exports it if the trace is sampled. Later calls
+// do nothing.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+
+	if s.exporter != nil && s.Context.Sampled() {
+		s.exporter.Export(s)
+	}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span in ctx, or nil if there isn't one.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// StartSpan starts a span as a child of the span in ctx, and returns a
+// context carrying it. Without a span in ctx there's no trace to add to, so
+// it starts a new one that isn't exported.
+func StartSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	var span *Span
+	if parent := SpanFromContext(ctx); parent != nil {
+		span = newSpan(name, kind, parent.Context, parent.exporter)
+	} else {
+		span = newSpan(name, kind, SpanContext{}, nil)
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// Starts a span continuing the trace of parent, or a new sampled trace when
+// parent isn't valid
+func newSpan(name string, kind SpanKind, parent SpanContext, exporter Exporter) *Span {
+	sc := SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+	} else {
+		sc.TraceID = newTraceID()
+		sc.Flags = FlagSampled
+	}
+
+	return &Span{
+		Name:       name,
+		Kind:       kind,
+		Context:    sc,
+		Parent:     parent.SpanID,
+		StartTime:  time.Now(),
+		attributes: map[string]any{},
+		exporter:   exporter,
+	}
+}
+
+// Inject adds traceparent and tracestate headers for the span in ctx to an
+// outgoing request's headers, so the receiving service continues the trace.
+func Inject(ctx context.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	header.Set("Traceparent", span.Context.Traceparent())
+	if span.Context.TraceState != "" {
+		header.Set("Tracestate", span.Context.TraceState)
+	}
+}
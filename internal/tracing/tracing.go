@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"errors"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"net/http"
+	"strings"
+)
+
+type Options struct {
+	// Exporter receives finished spans. Spans are still created and
+	// propagated when nil, but not exported.
+	Exporter Exporter
+	// Route names the route a request belongs to, for the span name and
+	// http.route attribute. Nil uses the path of the request target.
+	Route func(req *request.Request) string
+}
+
+// Middleware starts a server span for each request, continuing the trace
+// from the traceparent and tracestate headers when they're valid. The span is
+// in the request context for handlers to add attributes, start child spans
+// and pass the trace on with Inject or Transport. The span ends once the
+// response is complete, so middleware after this one is inside it.
+func Middleware(opts Options) server.Middleware {
+	if opts.Route == nil {
+		opts.Route = pathRoute
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			route := opts.Route(req)
+			method := req.RequestLine.Method
+			span := newSpan(method+" "+route, KindServer, extract(req), opts.Exporter)
+
+			path, _, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+			span.SetAttribute("http.request.method", method)
+			span.SetAttribute("http.route", route)
+			span.SetAttribute("url.path", path)
+			span.SetAttribute("network.protocol.version", req.RequestLine.HttpVersion)
+			span.SetAttribute("http.request.body.size", len(req.Body))
+			if req.RemoteAddr != "" {
+				span.SetAttribute("client.address", req.RemoteAddr)
+			}
+
+			rec := &response.Recorder{}
+			w.AddFilter(rec)
+			w.OnDone(func() {
+				span.SetAttribute("http.response.status_code", int(rec.StatusCode))
+				span.SetAttribute("http.response.body.size", rec.BytesWritten)
+				if rec.StatusCode >= 500 {
+					span.SetError(errors.New(http.StatusText(int(rec.StatusCode))))
+				}
+				span.End()
+			})
+			next(w, req.WithContext(ContextWithSpan(req.Context(), span)))
+		}
+	}
+}
+
+// The caller's span context from the request headers. A tracestate without
+// a valid traceparent is meaningless and dropped, as is an invalid one.
+func extract(req *request.Request) SpanContext {
+	traceparent, ok := req.Headers.Get("Traceparent")
+	if !ok {
+		return SpanContext{}
+	}
+	sc, err := ParseTraceparent(traceparent)
+	if err != nil {
+		return SpanContext{}
+	}
+	if traceState, ok := req.Headers.Get("Tracestate"); ok && ValidTraceState(traceState) {
+		sc.TraceState = traceState
+	}
+	return sc
+}
+
+func pathRoute(req *request.Request) string {
+	path, _, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+	return path
+}
+
+// Transport is an http.RoundTripper that records a client span for each
+// outgoing request whose context has a span, and passes the trace on in the
+// request headers. The span ends once the response headers arrive.
+type Transport struct {
+	// Base makes the requests, http.DefaultTransport when nil
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if SpanFromContext(req.Context()) == nil {
+		return base.RoundTrip(req)
+	}
+
+	ctx, span := StartSpan(req.Context(), req.Method+" "+req.URL.Host, KindClient)
+	defer span.End()
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("url.full", req.URL.Redacted())
+	span.SetAttribute("server.address", req.URL.Hostname())
+
+	// RoundTrippers mustn't modify the request they're given
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.response.status_code", res.StatusCode)
+	if res.StatusCode >= 500 {
+		span.SetError(errors.New(res.Status))
+	}
+	return res, nil
+}
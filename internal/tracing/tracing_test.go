@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"bytes"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	exporter := &MemoryExporter{}
+	var handlerSpan *Span
+	handler := Middleware(Options{Exporter: exporter})(func(w *response.Writer, req *request.Request) {
+		handlerSpan = SpanFromContext(req.Context())
+		body := []byte("oops")
+		w.WriteStatusLine(response.StatusInternalServerError)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	})
+	serve := func(raw string) *Span {
+		exporter.Reset()
+		req, err := request.RequestFromReader(strings.NewReader(raw))
+		require.NoError(t, err)
+		req.RemoteAddr = "192.0.2.7:51234"
+		var out bytes.Buffer
+		w := response.NewWriter(&out)
+		handler(w, req)
+		// The span ends with the response
+		require.Empty(t, exporter.Spans())
+		require.NoError(t, w.Finish())
+		spans := exporter.Spans()
+		require.Len(t, spans, 1)
+		return spans[0]
+	}
+
+	// Test: Incoming trace is continued with a new span, tracestate kept
+	span := serve("POST /items?page=2 HTTP/1.1\r\nHost: localhost\r\n" +
+		"Traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\r\n" +
+		"Tracestate: rojo=00f067aa0ba902b7\r\nContent-Length: 4\r\n\r\ndata")
+	assert.Same(t, span, handlerSpan)
+	assert.Equal(t, "POST /items", span.Name)
+	assert.Equal(t, KindServer, span.Kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.Context.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent.String())
+	assert.NotEqual(t, span.Parent, span.Context.SpanID)
+	assert.Equal(t, "rojo=00f067aa0ba902b7", span.Context.TraceState)
+
+	// Test: Request and response attributes, 5xx marks the span failed
+	attrs := span.Attributes()
+	assert.Equal(t, "POST", attrs["http.request.method"])
+	assert.Equal(t, "/items", attrs["http.route"])
+	assert.Equal(t, 500, attrs["http.response.status_code"])
+	assert.Equal(t, 4, attrs["http.request.body.size"])
+	assert.Equal(t, int64(4), attrs["http.response.body.size"])
+	assert.Equal(t, "192.0.2.7:51234", attrs["client.address"])
+	assert.Equal(t, "Internal Server Error", span.Error)
+
+	// Test: Invalid traceparent starts a new trace and drops tracestate
+	span = serve("GET / HTTP/1.1\r\nHost: localhost\r\n" +
+		"Traceparent: 00-zzz\r\nTracestate: rojo=1\r\n\r\n")
+	assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.Context.TraceID.String())
+	assert.False(t, span.Parent.IsValid())
+	assert.True(t, span.Context.Sampled())
+	assert.Empty(t, span.Context.TraceState)
+
+	// Test: Invalid tracestate alone is dropped
+	span = serve("GET / HTTP/1.1\r\nHost: localhost\r\n" +
+		"Traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\r\n" +
+		"Tracestate: Rojo=1\r\n\r\n")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.Context.TraceID.String())
+	assert.Empty(t, span.Context.TraceState)
+}
+
+func TestTransport(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	exporter := &MemoryExporter{}
+	parent := newSpan("GET /proxy", KindServer,
+		SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Flags: FlagSampled, TraceState: "rojo=1"}, exporter)
+	client := &http.Client{Transport: &Transport{}}
+
+	// Test: Outgoing request carries a client span's context
+	req, err := http.NewRequestWithContext(ContextWithSpan(t.Context(), parent), "GET", upstream.URL+"/get", nil)
+	require.NoError(t, err)
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	header := <-headers
+	assert.Empty(t, req.Header.Get("Traceparent"))
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, KindClient, span.Kind)
+	assert.Equal(t, parent.Context.SpanID, span.Parent)
+	assert.Equal(t, span.Context.Traceparent(), header.Get("Traceparent"))
+	assert.Equal(t, "rojo=1", header.Get("Tracestate"))
+	assert.Equal(t, 200, span.Attributes()["http.response.status_code"])
+
+	// Test: Requests outside a trace are sent untouched
+	res, err = client.Get(upstream.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Empty(t, (<-headers).Get("Traceparent"))
+}
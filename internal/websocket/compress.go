@@ -0,0 +1,78 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Both sides reset their compression context for every message, which keeps
+// per-connection state to a minimum at some cost in compression ratio
+const deflateResponse = "permessage-deflate; server_no_context_takeover; client_no_context_takeover"
+
+// Empty stored block that ends each compressed message and is stripped
+// before sending, per RFC 7692 section 7.2.1
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+
+var errInflateLimit = errors.New("inflated message too large")
+
+// Accept the first permessage-deflate offer whose parameters can be honored.
+// The compressor always uses a full 32KB window so offers limiting the
+// server's window are declined.
+func acceptDeflate(extensions string) bool {
+	for _, offer := range strings.Split(extensions, ",") {
+		params := strings.Split(offer, ";")
+		if strings.TrimSpace(params[0]) != "permessage-deflate" {
+			continue
+		}
+
+		ok := true
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			switch strings.TrimSpace(name) {
+			case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+			case "server_max_window_bits":
+				ok = strings.Trim(strings.TrimSpace(value), "\"") == "15"
+			default:
+				ok = false
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	fw.Write(data)
+	fw.Flush()
+	return bytes.TrimSuffix(buf.Bytes(), deflateTail)
+}
+
+func inflate(data []byte, limit int64) ([]byte, error) {
+	// Restore the stripped tail and add a final empty block so the reader
+	// sees the end of the stream
+	r := flate.NewReader(io.MultiReader(
+		bytes.NewReader(data),
+		bytes.NewReader(deflateTail),
+		bytes.NewReader([]byte{0x01, 0x00, 0x00, 0xff, 0xff}),
+	))
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > limit {
+		return nil, errInflateLimit
+	}
+	return out, nil
+}
@@ -0,0 +1,444 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"unicode/utf8"
+)
+
+// Message types, which are also the opcodes of their frames
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// Close codes from RFC 6455 section 7.4.1
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+// Control frames can't carry more than this many bytes
+const maxControlPayload = 125
+
+var ErrCloseSent = errors.New("websocket: close frame already sent")
+
+// CloseError is returned by ReadMessage once the connection is closed, either
+// because the peer sent a close frame or because it violated the protocol
+// and the server failed the connection with the given code.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("websocket: close %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: close %d: %s", e.Code, e.Text)
+}
+
+// Conn is a WebSocket connection. One goroutine may read while others
+// write; writes are serialized so control frames can be sent at any time.
+type Conn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	isServer    bool
+	subprotocol string
+	compress    bool
+	readLimit   int64
+	pongHandler func(data []byte)
+
+	writeMu   sync.Mutex
+	closeSent bool
+}
+
+type frame struct {
+	fin     bool
+	rsv1    bool
+	opcode  int
+	payload []byte
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, isServer bool) *Conn {
+	return &Conn{
+		conn:      conn,
+		br:        br,
+		isServer:  isServer,
+		readLimit: DefaultReadLimit,
+	}
+}
+
+// Subprotocol returns the subprotocol negotiated during the handshake.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// SetReadLimit sets the maximum size of a message read from the peer. Larger
+// messages fail the connection with CloseMessageTooBig.
+func (c *Conn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+// SetPongHandler sets a function called with the payload of each pong.
+func (c *Conn) SetPongHandler(h func(data []byte)) {
+	c.pongHandler = h
+}
+
+// RemoteAddr returns the address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// ReadMessage returns the next complete data message, reassembling fragments.
+// Pings are answered and pongs passed to the pong handler while waiting. When
+// the peer closes the connection or breaks the protocol, the close handshake
+// is completed, the connection is closed and a *CloseError is returned.
+func (c *Conn) ReadMessage() (messageType int, p []byte, err error) {
+	data := make([]byte, 0)
+	compressed := false
+
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return 0, nil, c.fail(err)
+		}
+
+		switch f.opcode {
+		case PingMessage:
+			if err := c.writeFrame(true, false, PongMessage, f.payload); err != nil && err != ErrCloseSent {
+				return 0, nil, c.fail(err)
+			}
+			continue
+		case PongMessage:
+			if c.pongHandler != nil {
+				c.pongHandler(f.payload)
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, c.handleClose(f.payload)
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail(protocolError(CloseProtocolError, "expected continuation frame"))
+			}
+			messageType = f.opcode
+			compressed = f.rsv1
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.fail(protocolError(CloseProtocolError, "unexpected continuation frame"))
+			}
+			if f.rsv1 {
+				return 0, nil, c.fail(protocolError(CloseProtocolError, "rsv1 set on continuation frame"))
+			}
+		default:
+			return 0, nil, c.fail(protocolError(CloseProtocolError, fmt.Sprintf("reserved opcode %d", f.opcode)))
+		}
+
+		data = append(data, f.payload...)
+		if int64(len(data)) > c.readLimit {
+			return 0, nil, c.fail(protocolError(CloseMessageTooBig, "message too big"))
+		}
+		if !f.fin {
+			continue
+		}
+
+		if compressed {
+			data, err = inflate(data, c.readLimit)
+			if err == errInflateLimit {
+				return 0, nil, c.fail(protocolError(CloseMessageTooBig, "message too big"))
+			}
+			if err != nil {
+				return 0, nil, c.fail(protocolError(CloseProtocolError, "invalid compressed message"))
+			}
+		}
+		if messageType == TextMessage && !utf8.Valid(data) {
+			return 0, nil, c.fail(protocolError(CloseInvalidFramePayloadData, "invalid UTF-8 in text message"))
+		}
+		return messageType, data, nil
+	}
+}
+
+// WriteMessage sends a data message in a single frame, or a control message.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	switch messageType {
+	case TextMessage, BinaryMessage:
+		if c.compress {
+			return c.writeFrame(true, true, messageType, deflate(data))
+		}
+		return c.writeFrame(true, false, messageType, data)
+	case PingMessage, PongMessage:
+		if len(data) > maxControlPayload {
+			return fmt.Errorf("websocket: control payload larger than %d bytes", maxControlPayload)
+		}
+		return c.writeFrame(true, false, messageType, data)
+	case CloseMessage:
+		return c.WriteClose(CloseNormalClosure, string(data))
+	default:
+		return fmt.Errorf("websocket: unknown message type %d", messageType)
+	}
+}
+
+// NextWriter returns a writer that sends each write as a fragment of a single
+// data message, ending the message on Close. Only one message can be written
+// at a time, although control frames may be interleaved.
+func (c *Conn) NextWriter(messageType int) (io.WriteCloser, error) {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return nil, fmt.Errorf("websocket: cannot fragment message type %d", messageType)
+	}
+	return &messageWriter{c: c, opcode: messageType}, nil
+}
+
+// WriteClose starts the closing handshake. The peer's close frame is then
+// returned by ReadMessage as a *CloseError, at which point the connection
+// is closed.
+func (c *Conn) WriteClose(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > maxControlPayload {
+		return fmt.Errorf("websocket: close reason too long")
+	}
+	return c.writeFrame(true, false, CloseMessage, payload)
+}
+
+// Close closes the underlying connection without a closing handshake.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Conn) readFrame() (frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return frame{}, err
+	}
+
+	f := frame{
+		fin:    header[0]&0x80 != 0,
+		rsv1:   header[0]&0x40 != 0,
+		opcode: int(header[0] & 0x0f),
+	}
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7f)
+	control := f.opcode >= CloseMessage
+
+	if header[0]&0x30 != 0 {
+		return frame{}, protocolError(CloseProtocolError, "reserved bits set")
+	}
+	if f.rsv1 && (!c.compress || control) {
+		return frame{}, protocolError(CloseProtocolError, "rsv1 set without compression")
+	}
+	// Clients must mask every frame and servers must never mask
+	if masked != c.isServer {
+		return frame{}, protocolError(CloseProtocolError, "invalid frame masking")
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		if ext[0]&0x80 != 0 {
+			return frame{}, protocolError(CloseProtocolError, "invalid frame length")
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	if control && (length > maxControlPayload || !f.fin) {
+		return frame{}, protocolError(CloseProtocolError, "invalid control frame")
+	}
+	if length > c.readLimit {
+		return frame{}, protocolError(CloseMessageTooBig, "message too big")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return frame{}, err
+		}
+	}
+
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, f.payload); err != nil {
+		return frame{}, err
+	}
+	if masked {
+		maskBytes(mask, f.payload)
+	}
+
+	return f, nil
+}
+
+func (c *Conn) writeFrame(fin, rsv1 bool, opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return ErrCloseSent
+	}
+
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	if rsv1 {
+		b0 |= 0x40
+	}
+	buf := []byte{b0, 0}
+
+	length := len(payload)
+	switch {
+	case length <= 125:
+		buf[1] = byte(length)
+	case length <= 0xffff:
+		buf[1] = 126
+		buf = binary.BigEndian.AppendUint16(buf, uint16(length))
+	default:
+		buf[1] = 127
+		buf = binary.BigEndian.AppendUint64(buf, uint64(length))
+	}
+
+	if c.isServer {
+		buf = append(buf, payload...)
+	} else {
+		var mask [4]byte
+		rand.Read(mask[:])
+		buf[1] |= 0x80
+		buf = append(buf, mask[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(mask, buf[start:])
+	}
+
+	if opcode == CloseMessage {
+		c.closeSent = true
+	}
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// Answer a close frame from the peer, echoing its status code unless we
+// started the handshake, and close the connection
+func (c *Conn) handleClose(payload []byte) error {
+	code := CloseNoStatusReceived
+	text := ""
+
+	switch {
+	case len(payload) == 1:
+		return c.fail(protocolError(CloseProtocolError, "invalid close payload"))
+	case len(payload) >= 2:
+		code = int(binary.BigEndian.Uint16(payload))
+		text = string(payload[2:])
+		if !validCloseCode(code) {
+			return c.fail(protocolError(CloseProtocolError, fmt.Sprintf("invalid close code %d", code)))
+		}
+		if !utf8.ValidString(text) {
+			return c.fail(protocolError(CloseInvalidFramePayloadData, "invalid UTF-8 in close reason"))
+		}
+	}
+
+	reply := make([]byte, 0, 2)
+	if code != CloseNoStatusReceived {
+		reply = binary.BigEndian.AppendUint16(reply, uint16(code))
+	}
+	c.writeFrame(true, false, CloseMessage, reply)
+	c.conn.Close()
+
+	return &CloseError{Code: code, Text: text}
+}
+
+// Fail the connection, sending a close frame for protocol violations
+func (c *Conn) fail(err error) error {
+	var pe *CloseError
+	if errors.As(err, &pe) {
+		c.WriteClose(pe.Code, "")
+	}
+	c.conn.Close()
+	return err
+}
+
+func protocolError(code int, text string) error {
+	return &CloseError{Code: code, Text: text}
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003:
+		return true
+	case code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+func maskBytes(mask [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= mask[i%4]
+	}
+}
+
+type messageWriter struct {
+	c       *Conn
+	opcode  int
+	started bool
+	closed  bool
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("websocket: write to closed message writer")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if err := w.c.writeFrame(false, false, w.frameOpcode(), p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *messageWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.c.writeFrame(true, false, w.frameOpcode(), nil)
+}
+
+// The first fragment carries the message type and the rest are continuations
+func (w *messageWriter) frameOpcode() int {
+	if w.started {
+		return continuationFrame
+	}
+	w.started = true
+	return w.opcode
+}
@@ -0,0 +1,171 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"net/url"
+	"strings"
+)
+
+// GUID appended to the client key when computing Sec-WebSocket-Accept
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Default maximum size of a message read from the peer
+const DefaultReadLimit = 16 << 20
+
+type Upgrader struct {
+	// Subprotocols the server supports in order of preference
+	Subprotocols []string
+	// CheckOrigin decides whether to accept a handshake from the request's
+	// origin. When nil, browsers may only connect from the same host.
+	CheckOrigin func(req *request.Request) bool
+	// EnableCompression negotiates the permessage-deflate extension when
+	// the client offers it
+	EnableCompression bool
+	// Maximum size of a message read from the peer, zero selects
+	// DefaultReadLimit
+	ReadLimit int64
+}
+
+// Upgrade performs the opening handshake and takes over the connection. On
+// failure it writes an error response and returns the error, so the handler
+// should simply return.
+func (u *Upgrader) Upgrade(w *response.Writer, req *request.Request) (*Conn, error) {
+	if req.RequestLine.Method != "GET" {
+		return nil, handshakeError(w, response.StatusMethodNotAllowed, "websocket handshake requires GET")
+	}
+	if !headerContainsToken(req, "Connection", "upgrade") {
+		return nil, handshakeError(w, response.StatusBadRequest, "missing Connection: upgrade")
+	}
+	if !headerContainsToken(req, "Upgrade", "websocket") {
+		return nil, handshakeError(w, response.StatusBadRequest, "missing Upgrade: websocket")
+	}
+	if version, _ := req.Headers.Get("Sec-WebSocket-Version"); version != "13" {
+		return nil, handshakeError(w, response.StatusUpgradeRequired, "unsupported websocket version")
+	}
+
+	key, _ := req.Headers.Get("Sec-WebSocket-Key")
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(decoded) != 16 {
+		return nil, handshakeError(w, response.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(req) {
+		return nil, handshakeError(w, response.StatusForbidden, "origin not allowed")
+	}
+
+	subprotocol := u.selectSubprotocol(req)
+	compress := false
+	if u.EnableCompression {
+		extensions, _ := req.Headers.Get("Sec-WebSocket-Extensions")
+		compress = acceptDeflate(extensions)
+	}
+
+	conn, err := w.Hijack()
+	if err != nil {
+		return nil, handshakeError(w, response.StatusInternalServerError, err.Error())
+	}
+
+	headers := response.GetDefaultHeaders(0)
+	headers.Remove("Content-Length")
+	headers.Remove("Content-Type")
+	headers.Replace("Connection", "Upgrade")
+	headers.Set("Upgrade", "websocket")
+	headers.Set("Sec-WebSocket-Accept", acceptKey(key))
+	if subprotocol != "" {
+		headers.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+	if compress {
+		headers.Set("Sec-WebSocket-Extensions", deflateResponse)
+	}
+
+	if err := response.WriteStatusLine(conn, response.StatusSwitchingProtocols); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := response.WriteHeaders(conn, headers); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	readLimit := u.ReadLimit
+	if readLimit == 0 {
+		readLimit = DefaultReadLimit
+	}
+
+	c := newConn(conn, bufio.NewReader(conn), true)
+	c.subprotocol = subprotocol
+	c.compress = compress
+	c.readLimit = readLimit
+	return c, nil
+}
+
+// Pick the first of the server's subprotocols that the client offered
+func (u *Upgrader) selectSubprotocol(req *request.Request) string {
+	offered, ok := req.Headers.Get("Sec-WebSocket-Protocol")
+	if !ok {
+		return ""
+	}
+
+	for _, supported := range u.Subprotocols {
+		for _, protocol := range strings.Split(offered, ",") {
+			if strings.TrimSpace(protocol) == supported {
+				return supported
+			}
+		}
+	}
+	return ""
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// Non-browser clients don't send Origin; browsers must come from the host
+// they are connecting to
+func sameOrigin(req *request.Request) bool {
+	origin, ok := req.Headers.Get("Origin")
+	if !ok {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host, _ := req.Headers.Get("Host")
+	return strings.EqualFold(u.Host, host)
+}
+
+func headerContainsToken(req *request.Request, name, token string) bool {
+	value, _ := req.Headers.Get(name)
+	for _, v := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), token) {
+			return true
+		}
+	}
+	return false
+}
+
+func handshakeError(w *response.Writer, status response.StatusCode, message string) error {
+	body := []byte(fmt.Sprintf("%d %s: %s\n", status, response.StatusText(status), message))
+	headers := response.GetDefaultHeaders(len(body))
+	if status == response.StatusUpgradeRequired {
+		headers.Set("Sec-WebSocket-Version", "13")
+	}
+
+	w.WriteStatusLine(status)
+	w.WriteHeaders(headers)
+	w.WriteBody(body)
+
+	return fmt.Errorf("websocket handshake failed: %s", message)
+}
@@ -0,0 +1,327 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const handshake = "GET /ws HTTP/1.1\r\n" +
+	"Host: localhost\r\n" +
+	"Upgrade: websocket\r\n" +
+	"Connection: keep-alive, Upgrade\r\n" +
+	"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+	"Sec-WebSocket-Version: 13\r\n"
+
+func TestAcceptKey(t *testing.T) {
+	// Test: Example from RFC 6455 section 1.3
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", acceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func TestHandshake(t *testing.T) {
+	u := &Upgrader{Subprotocols: []string{"graphql-ws", "chat"}}
+
+	// Test: Successful upgrade with subprotocol selection
+	res, _ := dial(t, u, "Sec-WebSocket-Protocol: chat, superchat\r\n")
+	assert.Equal(t, 101, res.StatusCode)
+	assert.Equal(t, "websocket", res.Header.Get("Upgrade"))
+	assert.Equal(t, "Upgrade", res.Header.Get("Connection"))
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", res.Header.Get("Sec-WebSocket-Accept"))
+	assert.Equal(t, "chat", res.Header.Get("Sec-WebSocket-Protocol"))
+	assert.Equal(t, "", res.Header.Get("Sec-WebSocket-Extensions"))
+
+	// Test: Unsupported version
+	res = rawHandshake(t, u, strings.Replace(handshake, "Version: 13", "Version: 8", 1))
+	assert.Equal(t, 426, res.StatusCode)
+	assert.Equal(t, "13", res.Header.Get("Sec-WebSocket-Version"))
+
+	// Test: Missing upgrade headers and bad key
+	res = rawHandshake(t, u, strings.Replace(handshake, "Upgrade: websocket\r\n", "", 1))
+	assert.Equal(t, 400, res.StatusCode)
+	res = rawHandshake(t, u, strings.Replace(handshake, "dGhlIHNhbXBsZSBub25jZQ==", "c2hvcnQ=", 1))
+	assert.Equal(t, 400, res.StatusCode)
+
+	// Test: Cross-origin requests are refused by default
+	res = rawHandshake(t, u, handshake+"Origin: https://evil.example\r\n")
+	assert.Equal(t, 403, res.StatusCode)
+	res, _ = dial(t, u, "Origin: http://localhost\r\n")
+	assert.Equal(t, 101, res.StatusCode)
+
+	// Test: permessage-deflate negotiation
+	u = &Upgrader{EnableCompression: true}
+	res, _ = dial(t, u, "Sec-WebSocket-Extensions: permessage-deflate; client_max_window_bits\r\n")
+	assert.Equal(t, deflateResponse, res.Header.Get("Sec-WebSocket-Extensions"))
+	res, _ = dial(t, u, "Sec-WebSocket-Extensions: permessage-deflate; server_max_window_bits=10\r\n")
+	assert.Equal(t, "", res.Header.Get("Sec-WebSocket-Extensions"))
+}
+
+func TestEcho(t *testing.T) {
+	u := &Upgrader{}
+
+	// Test: Text and binary messages across the payload length encodings
+	for _, size := range []int{0, 125, 126, 65535, 65536} {
+		_, c := dial(t, u, "")
+		payload := bytes.Repeat([]byte("*"), size)
+		require.NoError(t, c.WriteMessage(TextMessage, payload))
+		messageType, data, err := c.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, TextMessage, messageType)
+		assert.Equal(t, payload, data)
+
+		require.NoError(t, c.WriteMessage(BinaryMessage, payload))
+		messageType, data, err = c.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, BinaryMessage, messageType)
+		assert.Equal(t, payload, data)
+	}
+
+	// Test: Ping is answered with a pong carrying the same payload
+	_, c := dial(t, u, "")
+	pong := make(chan []byte, 1)
+	c.SetPongHandler(func(data []byte) { pong <- data })
+	require.NoError(t, c.WriteMessage(PingMessage, []byte("hello")))
+	require.NoError(t, c.WriteMessage(TextMessage, []byte("after ping")))
+	_, data, err := c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "after ping", string(data))
+	assert.Equal(t, "hello", string(<-pong))
+
+	// Test: Fragmented message with a ping between fragments
+	_, c = dial(t, u, "")
+	c.SetPongHandler(func([]byte) {})
+	require.NoError(t, c.writeFrame(false, false, TextMessage, []byte("frag")))
+	require.NoError(t, c.writeFrame(true, false, PingMessage, []byte("ping")))
+	require.NoError(t, c.writeFrame(false, false, continuationFrame, []byte("men")))
+	require.NoError(t, c.writeFrame(true, false, continuationFrame, []byte("ted")))
+	_, data, err = c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "fragmented", string(data))
+
+	// Test: Fragmented writes through NextWriter
+	_, c = dial(t, u, "")
+	mw, err := c.NextWriter(BinaryMessage)
+	require.NoError(t, err)
+	mw.Write([]byte{1, 2})
+	mw.Write([]byte{3})
+	require.NoError(t, mw.Close())
+	messageType, data, err := c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, BinaryMessage, messageType)
+	assert.Equal(t, []byte{1, 2, 3}, data)
+
+	// Test: Valid UTF-8 split across fragments
+	_, c = dial(t, u, "")
+	euro := []byte("€")
+	require.NoError(t, c.writeFrame(false, false, TextMessage, euro[:1]))
+	require.NoError(t, c.writeFrame(true, false, continuationFrame, euro[1:]))
+	_, data, err = c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "€", string(data))
+
+	// Test: Compressed messages in both directions
+	u = &Upgrader{EnableCompression: true}
+	_, c = dial(t, u, "Sec-WebSocket-Extensions: permessage-deflate\r\n")
+	c.compress = true
+	payload := strings.Repeat("compress me ", 100)
+	require.NoError(t, c.WriteMessage(TextMessage, []byte(payload)))
+	f, err := c.readFrame()
+	require.NoError(t, err)
+	assert.True(t, f.rsv1)
+	assert.Less(t, len(f.payload), len(payload))
+	data, err = inflate(f.payload, DefaultReadLimit)
+	require.NoError(t, err)
+	assert.Equal(t, payload, string(data))
+}
+
+func TestCloseHandshake(t *testing.T) {
+	u := &Upgrader{}
+
+	// Test: Close code is echoed
+	_, c := dial(t, u, "")
+	require.NoError(t, c.WriteClose(CloseGoingAway, "bye"))
+	assertClose(t, c, CloseGoingAway)
+
+	// Test: Empty close frame is answered with an empty close frame
+	_, c = dial(t, u, "")
+	require.NoError(t, c.writeFrame(true, false, CloseMessage, nil))
+	f, err := c.readFrame()
+	require.NoError(t, err)
+	assert.Equal(t, CloseMessage, f.opcode)
+	assert.Empty(t, f.payload)
+
+	// Test: Invalid close payloads
+	for _, payload := range [][]byte{
+		{0x03},
+		binary.BigEndian.AppendUint16(nil, 999),
+		binary.BigEndian.AppendUint16(nil, CloseNoStatusReceived),
+		binary.BigEndian.AppendUint16(nil, 1016),
+	} {
+		_, c = dial(t, u, "")
+		c.closeSent = false
+		require.NoError(t, c.writeFrame(true, false, CloseMessage, payload))
+		assertClose(t, c, CloseProtocolError)
+	}
+
+	_, c = dial(t, u, "")
+	require.NoError(t, c.writeFrame(true, false, CloseMessage, append(binary.BigEndian.AppendUint16(nil, 1000), 0xff)))
+	assertClose(t, c, CloseInvalidFramePayloadData)
+}
+
+func TestProtocolViolations(t *testing.T) {
+	u := &Upgrader{ReadLimit: 1024}
+
+	cases := []struct {
+		name string
+		send func(c *Conn) error
+		code int
+	}{
+		{"reserved bits", func(c *Conn) error {
+			return c.writeRaw(0x80|0x20|TextMessage, []byte("x"))
+		}, CloseProtocolError},
+		{"rsv1 without compression", func(c *Conn) error {
+			return c.writeRaw(0x80|0x40|TextMessage, []byte("x"))
+		}, CloseProtocolError},
+		{"reserved data opcode", func(c *Conn) error {
+			return c.writeRaw(0x80|3, nil)
+		}, CloseProtocolError},
+		{"reserved control opcode", func(c *Conn) error {
+			return c.writeRaw(0x80|0x0b, nil)
+		}, CloseProtocolError},
+		{"oversized ping", func(c *Conn) error {
+			return c.writeFrame(true, false, PingMessage, make([]byte, 126))
+		}, CloseProtocolError},
+		{"fragmented ping", func(c *Conn) error {
+			return c.writeFrame(false, false, PingMessage, []byte("x"))
+		}, CloseProtocolError},
+		{"continuation without start", func(c *Conn) error {
+			return c.writeFrame(true, false, continuationFrame, []byte("x"))
+		}, CloseProtocolError},
+		{"new message during fragmented message", func(c *Conn) error {
+			c.writeFrame(false, false, TextMessage, []byte("x"))
+			return c.writeFrame(true, false, TextMessage, []byte("y"))
+		}, CloseProtocolError},
+		{"invalid UTF-8", func(c *Conn) error {
+			return c.writeFrame(true, false, TextMessage, []byte{0xce, 0xba, 0xe1, 0xbd, 0xb9, 0xcf, 0x83, 0xce, 0xbc, 0xce, 0xb5, 0xed, 0xa0, 0x80})
+		}, CloseInvalidFramePayloadData},
+		{"message over the read limit", func(c *Conn) error {
+			return c.writeFrame(true, false, BinaryMessage, make([]byte, 2048))
+		}, CloseMessageTooBig},
+		{"fragmented message over the read limit", func(c *Conn) error {
+			c.writeFrame(false, false, BinaryMessage, make([]byte, 1000))
+			return c.writeFrame(true, false, continuationFrame, make([]byte, 1000))
+		}, CloseMessageTooBig},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, c := dial(t, u, "")
+			require.NoError(t, tc.send(c))
+			assertClose(t, c, tc.code)
+		})
+	}
+
+	// Test: Unmasked client frames are refused
+	_, c := dial(t, u, "")
+	c.isServer = true
+	require.NoError(t, c.writeFrame(true, false, TextMessage, []byte("x")))
+	c.isServer = false
+	assertClose(t, c, CloseProtocolError)
+}
+
+// Start an echo server on loopback and complete a handshake with it
+func dial(t *testing.T, u *Upgrader, extraHeaders string) (*http.Response, *Conn) {
+	t.Helper()
+
+	conn := listen(t, u)
+	_, err := conn.Write([]byte(handshake + extraHeaders + "\r\n"))
+	require.NoError(t, err)
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, &http.Request{Method: "GET"})
+	require.NoError(t, err)
+	require.Equal(t, 101, res.StatusCode)
+
+	return res, newConn(conn, br, false)
+}
+
+func rawHandshake(t *testing.T, u *Upgrader, raw string) *http.Response {
+	t.Helper()
+
+	conn := listen(t, u)
+	_, err := conn.Write([]byte(raw + "\r\n"))
+	require.NoError(t, err)
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "GET"})
+	require.NoError(t, err)
+	return res
+}
+
+func listen(t *testing.T, u *Upgrader) net.Conn {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		req, err := request.RequestFromReader(conn)
+		if err != nil {
+			conn.Close()
+			return
+		}
+
+		w := response.NewWriter(conn)
+		ws, err := u.Upgrade(w, req)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		for {
+			messageType, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := ws.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func assertClose(t *testing.T, c *Conn, code int) {
+	t.Helper()
+
+	f, err := c.readFrame()
+	require.NoError(t, err)
+	require.Equal(t, CloseMessage, f.opcode)
+	require.GreaterOrEqual(t, len(f.payload), 2)
+	assert.Equal(t, code, int(binary.BigEndian.Uint16(f.payload)))
+}
+
+// Write a masked frame with an arbitrary first header byte
+func (c *Conn) writeRaw(b0 byte, payload []byte) error {
+	buf := []byte{b0, 0x80 | byte(len(payload)), 0, 0, 0, 0}
+	buf = append(buf, payload...)
+	_, err := c.conn.Write(buf)
+	return err
+}